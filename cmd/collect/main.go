@@ -8,7 +8,7 @@ import (
 	"github.com/urfave/cli/v2"
 	"github.com/wiedzmin/toolbox/impl"
 	"github.com/wiedzmin/toolbox/impl/fs"
-	"github.com/wiedzmin/toolbox/impl/redis"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"go.uber.org/zap"
 )
 
@@ -20,7 +20,7 @@ func perform(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	r, err := redis.NewRedisLocal()
+	r, err := store.Shared()
 	if err != nil {
 		return err
 	}
@@ -30,7 +30,7 @@ func perform(ctx *cli.Context) error {
 func createCLI() *cli.App {
 	app := cli.NewApp()
 	app.Name = "Collect"
-	app.Usage = "Collect files for given regexps recursively ans save them under given Redis key"
+	app.Usage = "Collect files for given regexps recursively ans save them under given metadata store key"
 	app.Description = "Collect"
 	app.Version = "0.0.1#master"
 
@@ -50,10 +50,12 @@ func createCLI() *cli.App {
 		&cli.StringFlag{
 			Name:     "key",
 			Aliases:  []string{"k"},
-			Usage:    "Redis key name to save collected files under",
+			Usage:    "Store key name to save collected files under",
 			Required: true,
 		},
 	}
+	app.Flags = append(app.Flags, store.CLIFlags()...)
+	app.Before = store.ConfigureFromContext
 	app.Action = perform
 	return app
 }
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/urfave/cli/v2"
 	"github.com/wiedzmin/toolbox/impl"
@@ -13,10 +15,29 @@ import (
 var logger *zap.Logger
 
 func perform(ctx *cli.Context) error {
-	err := shell.RunDetached(ctx.String("command"))
+	l := logger.Sugar()
+	logPath := ctx.String("log-file")
+	if logPath == "" && ctx.Bool("log") {
+		var err error
+		logPath, err = shell.DetachedLogPath(ctx.String("command"))
+		if err != nil {
+			return err
+		}
+	}
+	pid, err := shell.RunDetached(ctx.String("command"), logPath)
 	if err != nil {
 		return err
 	}
+	l.Debugw("[perform]", "pid", pid, "logPath", logPath)
+	if ctx.Bool("print-pid") {
+		fmt.Println(pid)
+	}
+	if ctx.String("pid-file") != "" {
+		err = os.WriteFile(ctx.String("pid-file"), []byte(strconv.Itoa(pid)), 0644)
+		if err != nil {
+			return err
+		}
+	}
 	if ctx.String("input") != "" {
 		inp := ctx.String("input")
 		err = xserver.WriteClipboard(&inp, false)
@@ -41,6 +62,28 @@ func createCLI() *cli.App {
 			Usage:    "command to run (with parameters)",
 			Required: true,
 		},
+		&cli.BoolFlag{
+			Name:     "log",
+			Aliases:  []string{"l"},
+			Usage:    "Append command output to per-command log file, under ~/.cache/toolbox/detached",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "log-file",
+			Usage:    "Append command output to given log file",
+			Required: false,
+		},
+		&cli.BoolFlag{
+			Name:     "print-pid",
+			Aliases:  []string{"p"},
+			Usage:    "Print PID of started process",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "pid-file",
+			Usage:    "Write PID of started process to given file",
+			Required: false,
+		},
 		&cli.StringFlag{
 			Name:     "input",
 			Aliases:  []string{"i"},
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/urfave/cli/v2"
 	"github.com/wiedzmin/toolbox/impl"
@@ -74,18 +75,22 @@ func edit(ctx *cli.Context) error {
 
 func remove(ctx *cli.Context) error {
 	l := logger.Sugar()
-	sessionName, err := browsers.SelectSession(ctx.String("dumps-path"), "remove", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), nil, nil)
-	l.Debugw("[remove]", "sessionName", sessionName, "err", err)
+	sessionNames, err := browsers.SelectSessions(ctx.String("dumps-path"), "remove", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), nil, nil)
+	l.Debugw("[remove]", "sessionNames", sessionNames, "err", err)
 	if err != nil {
 		return err
 	}
-	sessionPath := fmt.Sprintf("%s/%s", ctx.String("dumps-path"), *sessionName)
-	err = os.Remove(sessionPath)
-	if err != nil {
-		return err
+	var removed []string
+	for _, sessionName := range sessionNames {
+		sessionPath := fmt.Sprintf("%s/%s", ctx.String("dumps-path"), sessionName)
+		err = os.Remove(sessionPath)
+		if err != nil {
+			return err
+		}
+		l.Debugw("[remove]", "removed", sessionPath)
+		removed = append(removed, sessionPath)
 	}
-	l.Debugw("[remove]", "removed", sessionPath)
-	ui.NotifyNormal("[ffsessions]", fmt.Sprintf("Removed %s", sessionPath))
+	ui.NotifyNormal("[ffsessions]", fmt.Sprintf("Removed %s", strings.Join(removed, "\n")))
 	return nil
 }
 
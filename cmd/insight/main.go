@@ -1,24 +1,35 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/urfave/cli/v2"
 	"github.com/wiedzmin/toolbox/impl"
-	"github.com/wiedzmin/toolbox/impl/redis"
-	"github.com/wiedzmin/toolbox/impl/shell"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"go.uber.org/zap"
 )
 
 var logger *zap.Logger
 
+// openWith runs viewer command, e.g. "zathura --fork", with selected items as arguments
+func openWith(viewerCmd string, items []ui.Item) error {
+	argv := strings.Fields(viewerCmd)
+	for _, item := range items {
+		argv = append(argv, item.Display)
+	}
+	return proc.Run(context.Background(), argv, proc.Options{})
+}
+
 func docs(ctx *cli.Context) error {
 	l := logger.Sugar()
 	var result []string
-	r, err := redis.NewRedisLocal()
+	r, err := store.Shared()
 	if err != nil {
 		return err
 	}
@@ -38,14 +49,15 @@ func docs(ctx *cli.Context) error {
 		result = append(result, docs...)
 	}
 
-	doc, err := ui.GetSelection(result, "open", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, true)
+	selection, err := ui.GetMultiSelection(ui.Items(result), "open", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, true)
 	if err != nil {
 		ui.NotifyNormal("[insight]", "no document selected")
 		return err
 	}
-	fmt.Printf("doc: %s\n", doc)
-	_, err = shell.ShellCmd(fmt.Sprintf("%s \"%s\"", ctx.String("office-command"), doc),
-		nil, nil, nil, false, false)
+	for _, item := range selection {
+		fmt.Printf("doc: %s\n", item.Display)
+	}
+	err = openWith(ctx.String("office-command"), selection)
 	if err != nil {
 		return err
 	}
@@ -55,7 +67,7 @@ func docs(ctx *cli.Context) error {
 func ebooks(ctx *cli.Context) error {
 	l := logger.Sugar()
 	var result []string
-	r, err := redis.NewRedisLocal()
+	r, err := store.Shared()
 	if err != nil {
 		return err
 	}
@@ -75,14 +87,15 @@ func ebooks(ctx *cli.Context) error {
 		result = append(result, ebooks...)
 	}
 
-	book, err := ui.GetSelection(result, "open", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, true)
+	selection, err := ui.GetMultiSelection(ui.Items(result), "open", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, true)
 	if err != nil {
 		ui.NotifyNormal("[insight]", "no book selected")
 		return err
 	}
-	fmt.Printf("book: %s\n", book)
-	_, err = shell.ShellCmd(fmt.Sprintf("%s \"%s\"", ctx.String("reader-command"), book),
-		nil, nil, nil, false, false)
+	for _, item := range selection {
+		fmt.Printf("book: %s\n", item.Display)
+	}
+	err = openWith(ctx.String("reader-command"), selection)
 	if err != nil {
 		return err
 	}
@@ -143,6 +156,9 @@ func createCLI() *cli.App {
 			Required: false,
 		},
 	}
+	app.Flags = append(app.Flags, store.CLIFlags()...)
+	app.Flags = append(app.Flags, ui.HistoryCLIFlags()...)
+	app.Before = ui.WithHistory(store.ConfigureReadOnlyFromContext)
 	return app
 }
 
@@ -143,7 +143,11 @@ func perform(ctx *cli.Context) error {
 	ui.NotifyNormal("[scrape]", fmt.Sprintf("scraping from %s", pageUrl.String()))
 
 	xkb.EnsureEnglishKeyboardLayout()
-	sessionName, err := ui.GetSelection([]string{}, "save as", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	var sessionName string
+	selection, err := ui.GetSelection(nil, "save as", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	if err == nil {
+		sessionName = selection.Display
+	}
 	l.Debugw("[perform]", "sessionName", sessionName, "err", err)
 	pageSoup, err := soup.Get(pageUrl.String())
 	l.Debugw("[perform]", "pageSoup", pageSoup, "err", err)
@@ -9,6 +9,7 @@ import (
 	"github.com/wiedzmin/toolbox/impl"
 	"github.com/wiedzmin/toolbox/impl/bookmarks"
 	"github.com/wiedzmin/toolbox/impl/shell"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"go.uber.org/zap"
 )
@@ -19,8 +20,20 @@ func formatBookmark(title string, bm bookmarks.Bookmark) string {
 	return fmt.Sprintf("%s - %s", title, bm.Path)
 }
 
+func selectPath(ctx *cli.Context, items []ui.Item, prompt string) (string, error) {
+	selection, err := ui.GetSelection(items, prompt, ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	if err != nil {
+		return "", err
+	}
+	bookmark, ok := selection.Value.(bookmarks.Bookmark)
+	if !ok {
+		return "", fmt.Errorf("no bookmark found for '%s'", selection.Display)
+	}
+	return strings.TrimSpace(bookmark.Path), nil
+}
+
 func perform(ctx *cli.Context) error {
-	bms, err := bookmarks.BookmarksFromRedis("nav/bookmarks")
+	bms, err := bookmarks.BookmarksFromStore("nav/bookmarks")
 	if err != nil {
 		return err
 	}
@@ -30,22 +43,21 @@ func perform(ctx *cli.Context) error {
 		return err
 	}
 
-	bookmarksForSelection := bookmarks.CustomKeyedMap(bmDirs, formatBookmark)
+	var items []ui.Item
+	for title, bookmark := range bmDirs {
+		items = append(items, ui.Item{Display: formatBookmark(title, bookmark), Value: bookmark})
+	}
 
-	selectionLeft, err := ui.GetSelection(bookmarks.GetBookmarksMapKeys(bookmarksForSelection), "left", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	pathLeft, err := selectPath(ctx, items, "left")
 	if err != nil {
 		return err
 	}
-	selectionRight, err := ui.GetSelection(bookmarks.GetBookmarksMapKeys(bookmarksForSelection), "right", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	pathRight, err := selectPath(ctx, items, "right")
 	if err != nil {
 		return err
 	}
 
-	return shell.RunInTerminal(
-		fmt.Sprintf("mc %s %s",
-			strings.TrimSpace(bookmarksForSelection[selectionLeft].Path),
-			strings.TrimSpace(bookmarksForSelection[selectionRight].Path)),
-		"mcpanes", shell.TermTraitsFromContext(ctx))
+	return shell.RunInTerminal(fmt.Sprintf("mc %s %s", pathLeft, pathRight), "mcpanes", shell.TermTraitsFromContext(ctx))
 }
 
 func createCLI() *cli.App {
@@ -82,10 +94,13 @@ func createCLI() *cli.App {
 			Aliases:  []string{"t"},
 			EnvVars:  []string{impl.EnvPrefix + "_TERMINAL_BACKEND"},
 			Value:    shell.TerminalBackendDefault,
-			Usage:    "Terminal backend to use",
+			Usage:    "Terminal backend to use, e.g. kitty, alacritty, wezterm, foot, tmux, tmux-split, zellij",
 			Required: false,
 		},
 	}
+	app.Flags = append(app.Flags, store.CLIFlags()...)
+	app.Flags = append(app.Flags, ui.HistoryCLIFlags()...)
+	app.Before = ui.WithHistory(store.ConfigureReadOnlyFromContext)
 	app.Action = perform
 	return app
 }
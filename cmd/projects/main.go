@@ -12,6 +12,7 @@ import (
 	"github.com/wiedzmin/toolbox/impl/emacs"
 	"github.com/wiedzmin/toolbox/impl/shell"
 	"github.com/wiedzmin/toolbox/impl/shell/tmux"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"github.com/wiedzmin/toolbox/impl/xserver"
 	"github.com/wiedzmin/toolbox/impl/xserver/xkb"
@@ -30,7 +31,7 @@ func open(ctx *cli.Context) error {
 	if ctx.String("path") != "" {
 		pathStr = ctx.String("path")
 	} else {
-		bookmarks, err := bookmarks.BookmarksFromRedis("nav/bookmarks")
+		bookmarks, err := bookmarks.BookmarksFromStore("nav/bookmarks")
 		if err != nil {
 			return err
 		}
@@ -39,11 +40,12 @@ func open(ctx *cli.Context) error {
 			keyStr = ctx.String("key")
 		} else {
 			xkb.EnsureEnglishKeyboardLayout()
-			keyStr, err = ui.GetSelection(bookmarks.Keys(), "open", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
-			l.Debugw("[open]", "key", keyStr, "err", err)
+			selection, err := ui.GetSelection(ui.Items(bookmarks.Keys()), "open", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+			l.Debugw("[open]", "selection", selection, "err", err)
 			if err != nil {
 				return err
 			}
+			keyStr = selection.Display
 		}
 		if bookmark := bookmarks.Get(keyStr); bookmark == nil {
 			l.Errorw("[open]", "failed to get bookmark metadata for", keyStr)
@@ -86,12 +88,13 @@ func search(ctx *cli.Context) error {
 	}
 
 	xkb.EnsureEnglishKeyboardLayout()
-	searchTerm, err := ui.GetSelection([]string{}, "token", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	termSelection, err := ui.GetSelection(nil, "token", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
 	if err != nil {
 		l.Warnw("[search]", "no keyword provided")
 		ui.NotifyCritical("[search repos]", "no keyword provided")
 		return err
 	}
+	searchTerm := termSelection.Display
 	impl.EnsureBinary("fd", *logger)
 	matchingRepos, err := shell.ShellCmd(fmt.Sprintf("fd -t d -d %d %s %s",
 		ctx.Int("depth"), searchTerm, ctx.String("root")), nil, nil, nil, true, false)
@@ -102,12 +105,13 @@ func search(ctx *cli.Context) error {
 	if len(*matchingRepos) > 0 {
 		matchingReposSlice := strings.Split(*matchingRepos, "\n")
 		xkb.EnsureEnglishKeyboardLayout()
-		path, err = ui.GetSelection(matchingReposSlice, "explore", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false) // FIXME: handle "no search results" case, do not show empty `dmenu`
+		selection, err := ui.GetSelection(ui.Items(matchingReposSlice), "explore", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false) // FIXME: handle "no search results" case, do not show empty `dmenu`
 		if err != nil {
 			l.Warnw("[search]", "no repository provided")
 			ui.NotifyNormal("[search repos]", "no repository selected")
 			return err
 		}
+		path = selection.Display
 	} else {
 		l.Debugw("[search]", "error", "no matching repos found")
 		ui.NotifyNormal("[search repos]", "no matching repos found")
@@ -224,10 +228,13 @@ func createCLI() *cli.App {
 			Name:     shell.TerminalBackendFlagName,
 			EnvVars:  []string{impl.EnvPrefix + "_TERMINAL_BACKEND"},
 			Value:    shell.TerminalBackendDefault,
-			Usage:    "Terminal backend to use",
+			Usage:    "Terminal backend to use, e.g. kitty, alacritty, wezterm, foot, tmux, tmux-split, zellij",
 			Required: false,
 		},
 	}
+	app.Flags = append(app.Flags, store.CLIFlags()...)
+	app.Flags = append(app.Flags, ui.HistoryCLIFlags()...)
+	app.Before = ui.WithHistory(store.ConfigureReadOnlyFromContext)
 	return app
 }
 
@@ -7,7 +7,7 @@ import (
 	"github.com/urfave/cli/v2"
 	"github.com/wiedzmin/toolbox/impl"
 	"github.com/wiedzmin/toolbox/impl/browsers/qutebrowser"
-	"github.com/wiedzmin/toolbox/impl/redis"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"github.com/wiedzmin/toolbox/impl/xserver/xkb"
 	"go.uber.org/zap"
@@ -15,7 +15,7 @@ import (
 
 var (
 	logger *zap.Logger
-	r      *redis.Client
+	r      store.Store
 )
 
 func getCurrentTarget() (string, error) {
@@ -34,11 +34,11 @@ func getCurrentTarget() (string, error) {
 
 func query(ctx *cli.Context, prompt string) (string, error) {
 	xkb.EnsureEnglishKeyboardLayout()
-	value, err := ui.GetSelection([]string{}, prompt, ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	value, err := ui.GetSelection(nil, prompt, ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
 	if err != nil {
 		return "", err
 	}
-	return value, nil
+	return value.Display, nil
 }
 
 func open(ctx *cli.Context) error {
@@ -84,6 +84,15 @@ func saveSession(ctx *cli.Context) error {
 	return qutebrowser.SaveSessionInternal(ctx.String("name"))
 }
 
+func connect(ctx *cli.Context) error {
+	err := store.ConfigureFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	r, err = store.Shared()
+	return err
+}
+
 func createCLI() *cli.App {
 	app := cli.NewApp()
 	app.Name = "Qbcli"
@@ -146,6 +155,8 @@ func createCLI() *cli.App {
 			Required: false,
 		},
 	}
+	app.Flags = append(app.Flags, store.CLIFlags()...)
+	app.Before = connect
 	return app
 }
 
@@ -154,14 +165,8 @@ func main() {
 	defer logger.Sync()
 	l := logger.Sugar()
 
-	var err error
-
-	r, err = redis.NewRedisLocal()
-	if err != nil {
-		l.Errorw("[main]", "err", err)
-	}
 	app := createCLI()
-	err = app.Run(os.Args)
+	err := app.Run(os.Args)
 	if err != nil {
 		l.Errorw("[main]", "err", err)
 	}
@@ -10,7 +10,7 @@ import (
 	"github.com/wiedzmin/toolbox/impl"
 	"github.com/wiedzmin/toolbox/impl/browsers/qutebrowser"
 	"github.com/wiedzmin/toolbox/impl/emacs"
-	"github.com/wiedzmin/toolbox/impl/redis"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"go.uber.org/zap"
 )
@@ -22,7 +22,7 @@ const (
 
 var (
 	logger *zap.Logger
-	r      *redis.Client
+	r      store.Store
 )
 
 func getCurrentTarget() (string, error) {
@@ -104,6 +104,15 @@ func perform(ctx *cli.Context) error {
 	return nil
 }
 
+func connect(ctx *cli.Context) error {
+	err := store.ConfigureFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	r, err = store.Shared()
+	return err
+}
+
 func createCLI() *cli.App {
 	app := cli.NewApp()
 	app.Name = "Qbtarget"
@@ -137,6 +146,8 @@ func createCLI() *cli.App {
 			Required: false,
 		},
 	}
+	app.Flags = append(app.Flags, store.CLIFlags()...)
+	app.Before = connect
 	app.Action = perform
 	return app
 }
@@ -146,14 +157,8 @@ func main() {
 	defer logger.Sync()
 	l := logger.Sugar()
 
-	var err error
-
-	r, err = redis.NewRedisLocal()
-	if err != nil {
-		l.Errorw("[main]", "err", err)
-	}
 	app := createCLI()
-	err = app.Run(os.Args)
+	err := app.Run(os.Args)
 	if err != nil {
 		l.Errorw("[main]", "err", err)
 	}
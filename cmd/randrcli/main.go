@@ -24,10 +24,11 @@ func fingerprint(ctx *cli.Context) error {
 	}
 	l.Debugw("[fingerprint]", "fingerprint", fp)
 	xkb.EnsureEnglishKeyboardLayout()
-	head, err := ui.GetSelection(heads, "head", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	selection, err := ui.GetSelection(ui.Items(heads), "head", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
 	if err != nil {
 		return err
 	}
+	head := selection.Display
 	if edid, ok := fp[head]; ok {
 		ui.NotifyNormal("[randrutil]", fmt.Sprintf("copying EDID for '%s' to clipboard", head))
 		return xserver.WriteClipboard(&edid, false)
@@ -47,27 +48,26 @@ func appTraits(ctx *cli.Context) error {
 		return err
 	}
 
-	traitsMap := make(map[string]xserver.WindowTraits)
-
-	var titles []string
+	var items []ui.Item
 	for _, win := range windows {
 		traits, err := x.GetWindowTraits(&win)
 		if err != nil {
 			return err
 		}
-		traitsMap[traits.Title] = *traits
-		titles = append(titles, traits.Title)
+		items = append(items, ui.Item{Display: traits.Title, Value: *traits})
 	}
 
-	title, err := ui.GetSelection(titles, "window", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	selection, err := ui.GetSelection(items, "window", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
 	if err != nil {
 		return err
 	}
-	if traits, ok := traitsMap[title]; ok {
-		traitName, err := ui.GetSelection(traits.ListNames(), ">", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	title := selection.Display
+	if traits, ok := selection.Value.(xserver.WindowTraits); ok {
+		traitSelection, err := ui.GetSelection(ui.Items(traits.ListNames()), ">", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
 		if err != nil {
 			return err
 		}
+		traitName := traitSelection.Display
 		if trait, ok := traits.AsMap()[traitName]; ok {
 			ui.NotifyNormal("[randrutil]", fmt.Sprintf("copying trait '%s' for '%s' to clipboard", traitName, impl.ShorterString(title, 20)))
 			return xserver.WriteClipboard(&trait, false)
@@ -95,11 +95,12 @@ func activate(ctx *cli.Context) error {
 	impl.EnsureBinary("autorandr", *logger)
 	profilesPath := fs.AtDotConfig("autorandr")
 
-	profile, err := ui.GetSelection(
-		fs.NewFSCollection(profilesPath, nil, []string{"\\.d$"}, true).Emit(false), "profile", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	selection, err := ui.GetSelection(
+		ui.Items(fs.NewFSCollection(profilesPath, nil, []string{"\\.d$"}, true).Emit(false)), "profile", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
 	if err != nil {
 		return err
 	}
+	profile := selection.Display
 
 	_, err = shell.ShellCmd(fmt.Sprintf("autorandr --load %s", profile), nil, nil, nil, false, false)
 	if err != nil {
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/wiedzmin/toolbox/impl"
+	"github.com/wiedzmin/toolbox/impl/store"
+	"github.com/wiedzmin/toolbox/impl/ui"
+	"go.uber.org/zap"
+)
+
+const maxAgeDefault = 90 * 24 * time.Hour
+
+var logger *zap.Logger
+
+func histories(ctx *cli.Context) (map[string]ui.History, error) {
+	r, err := store.Shared()
+	if err != nil {
+		return nil, err
+	}
+	pattern := ui.HistoryKeyPrefix + "*"
+	if ctx.String("namespace") != "" {
+		pattern = ui.HistoryKeyPrefix + strings.ToLower(ctx.String("namespace")) + ":*"
+	}
+	values, err := r.GetValuesMapFuzzy(pattern)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]ui.History)
+	for key, data := range values {
+		history, err := ui.NewHistory(data)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = history
+	}
+	return result, nil
+}
+
+func prune(ctx *cli.Context) error {
+	l := logger.Sugar()
+	r, err := store.Shared()
+	if err != nil {
+		return err
+	}
+	hs, err := histories(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for key, history := range hs {
+		dropped := history.Prune(now, ctx.Duration("max-age"))
+		l.Debugw("[prune]", "key", key, "dropped", dropped, "left", len(history))
+		if len(history) == 0 {
+			err = r.DeleteValue(key)
+		} else {
+			err = history.Save(key)
+		}
+		if err != nil {
+			return err
+		}
+		if dropped > 0 {
+			fmt.Printf("%s: dropped %d, left %d\n", strings.TrimPrefix(key, ui.HistoryKeyPrefix), dropped, len(history))
+		}
+	}
+	return nil
+}
+
+func show(ctx *cli.Context) error {
+	hs, err := histories(ctx)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for key := range hs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	now := time.Now()
+	for _, key := range keys {
+		fmt.Printf("%s:\n", strings.TrimPrefix(key, ui.HistoryKeyPrefix))
+		history := hs[key]
+		var displays []string
+		for d := range history {
+			displays = append(displays, d)
+		}
+		sort.SliceStable(displays, func(i, j int) bool {
+			return history[displays[i]].Score(now) > history[displays[j]].Score(now)
+		})
+		for _, d := range displays {
+			entry := history[d]
+			fmt.Printf("  %8.2f  %4d  %s  %s\n", entry.Score(now), entry.Count,
+				time.Unix(entry.Last, 0).Format(time.RFC3339), d)
+		}
+	}
+	return nil
+}
+
+func createCLI() *cli.App {
+	app := cli.NewApp()
+	app.Name = "Selhistory"
+	app.Usage = "Manages selection history, used for ranking selector options"
+	app.Description = "Selhistory"
+	app.Version = "0.0.1#master"
+
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:     "namespace",
+			Aliases:  []string{"n"},
+			Usage:    "Only take history of given command into account, e.g. webjumps",
+			Required: false,
+		},
+	}
+	app.Flags = append(app.Flags, store.CLIFlags()...)
+	app.Before = store.ConfigureFromContext
+	app.Commands = cli.Commands{
+		{
+			Name:   "prune",
+			Usage:  "Drop entries which were not selected for a long time",
+			Action: prune,
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:     "max-age",
+					Aliases:  []string{"a"},
+					Value:    maxAgeDefault,
+					Usage:    "Entries last selected earlier than that are dropped",
+					Required: false,
+				},
+			},
+		},
+		{
+			Name:   "show",
+			Usage:  "Show entries, ranked by frecency",
+			Action: show,
+		},
+	}
+	return app
+}
+
+func main() {
+	logger = impl.NewLogger()
+	defer logger.Sync()
+	l := logger.Sugar()
+	app := createCLI()
+	err := app.Run(os.Args)
+	if err != nil {
+		l.Errorw("[main]", "err", err)
+	}
+}
@@ -1,17 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"text/tabwriter"
+	"time"
 
+	jsoniter "github.com/json-iterator/go"
 	"github.com/urfave/cli/v2"
 	"github.com/wiedzmin/toolbox/impl"
-	"github.com/wiedzmin/toolbox/impl/redis"
+	"github.com/wiedzmin/toolbox/impl/notify"
 	"github.com/wiedzmin/toolbox/impl/shell"
 	"github.com/wiedzmin/toolbox/impl/shell/tmux"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"github.com/wiedzmin/toolbox/impl/systemd"
 	"github.com/wiedzmin/toolbox/impl/ui"
+	"github.com/wiedzmin/toolbox/impl/xserver"
 	"github.com/wiedzmin/toolbox/impl/xserver/xkb"
 	"go.uber.org/zap"
 )
@@ -19,6 +28,23 @@ import (
 const (
 	redisKeyName     = "system/services"
 	redisKeyNameFlat = "system/services/flat"
+
+	failureNotificationTimeout = 15 * time.Second
+
+	watchNotificationTimeout = time.Minute
+
+	operationTimeoutDefault  = 90 * time.Second
+	stillWaitingAfterDefault = 5 * time.Second
+	operationTimeoutFlagName = "timeout"
+
+	journalPriorityFlagName   = "priority"
+	journalSinceFlagName      = "since"
+	journalUntilFlagName      = "until"
+	journalGrepFlagName       = "grep"
+	journalLinesFlagName      = "lines"
+	journalBootFlagName       = "boot"
+	journalClipboardFlagName  = "clipboard"
+	stillWaitingAfterFlagName = "still-waiting-after"
 )
 
 var (
@@ -31,12 +57,94 @@ var (
 		"show",
 		"journal",
 		"journal/follow",
+		"journal/view",
+		"journal/errors",
+		"status",
+	}
+	// NOTE: journal operations are applied to triggered units, as timers themselves log next to nothing
+	TIMER_OPERATIONS = []string{
+		"trigger now",
+		"journal",
+		"journal/follow",
 		"status",
 	}
 	logger *zap.Logger
-	r      *redis.Client
+	r      store.Store
+	// rErr keeps the reason why store is unavailable, for commands which cannot do without it
+	rErr error
 )
 
+// entry is what gets cached in metadata store, as JSON, and selected by user
+// Operation is only set for flat mode entries
+type entry struct {
+	Name      string `json:"name"`
+	User      bool   `json:"user"`
+	Operation string `json:"op,omitempty"`
+}
+
+func (e entry) Unit() systemd.Unit {
+	return systemd.Unit{Name: e.Name, User: e.User}
+}
+
+func (e entry) String() string {
+	if e.Operation == "" {
+		return e.Unit().String()
+	}
+	return fmt.Sprintf("%s / %s", e.Unit().String(), e.Operation)
+}
+
+func isTimer(u systemd.Unit) bool {
+	return strings.HasSuffix(u.Name, "."+systemd.UNIT_TYPE_TIMER)
+}
+
+// operationsFor returns operations applicable to unit, timers could be triggered in addition to the common ones
+func operationsFor(u systemd.Unit) []string {
+	if isTimer(u) {
+		return append(slices.Clone(OPERATIONS), "trigger now")
+	}
+	return OPERATIONS
+}
+
+func entriesForUnit(u systemd.Unit, flat bool) []entry {
+	if !flat {
+		return []entry{{Name: u.Name, User: u.User}}
+	}
+	var result []entry
+	for _, op := range operationsFor(u) {
+		result = append(result, entry{Name: u.Name, User: u.User, Operation: op})
+	}
+	return result
+}
+
+func entriesToItems(entries []entry) []ui.Item {
+	var result []ui.Item
+	for _, e := range entries {
+		result = append(result, ui.Item{Display: e.String(), Value: e})
+	}
+	return result
+}
+
+// collectEntries collects units without caching, for the case when metadata store is unavailable
+func collectEntries(flat bool) ([]ui.Item, error) {
+	units, err := systemd.CollectUnits(true, true)
+	if err != nil {
+		return nil, err
+	}
+	var result []entry
+	for _, u := range units {
+		result = append(result, entriesForUnit(u, flat)...)
+	}
+	return entriesToItems(result), nil
+}
+
+func invalidateUnitsCache() error {
+	err := r.DeleteValue(redisKeyName)
+	if err != nil {
+		return err
+	}
+	return r.DeleteValue(redisKeyNameFlat)
+}
+
 func ensureUnitsCache(ctx *cli.Context) error {
 	var units []systemd.Unit
 	var err error
@@ -56,154 +164,680 @@ func ensureUnitsCache(ctx *cli.Context) error {
 	}
 	ui.NotifyNormal("[services]", "populating cache, please wait...")
 	for _, u := range units {
-		err = r.AppendToList(redisKeyName, u.String())
+		data, err := jsoniter.Marshal(entriesForUnit(u, false)[0])
 		if err != nil {
 			return err
 		}
-		for _, op := range OPERATIONS {
-			_ = r.AppendToList(redisKeyNameFlat, fmt.Sprintf("%s / %s", u.String(), op))
+		err = r.AppendToList(redisKeyName, string(data))
+		if err != nil {
+			return err
+		}
+		for _, e := range entriesForUnit(u, true) {
+			data, err = jsoniter.Marshal(e)
+			if err != nil {
+				return err
+			}
+			_ = r.AppendToList(redisKeyNameFlat, string(data))
 		}
 	}
 
 	return nil
 }
 
-func perform(ctx *cli.Context) error {
-	var err error
+// cachedEntries reads selector items from units cache
+// Entries of unknown format (e.g. left by previous versions) make cache invalidated and repopulated from scratch
+func cachedEntries(ctx *cli.Context) ([]ui.Item, error) {
 	l := logger.Sugar()
-	if ctx.Bool("invalidate-cache") {
-		err := systemd.DaemonReload()
+	redisKey := redisKeyName
+	if ctx.Bool("flat") {
+		redisKey = redisKeyNameFlat
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		err := ensureUnitsCache(ctx)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		err = r.DeleteValue(redisKeyName)
+		rawEntries, err := r.GetList(redisKey, 0, -1)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		entries, err := decodeEntries(rawEntries)
+		if err == nil {
+			return entriesToItems(entries), nil
 		}
-		err = r.DeleteValue(redisKeyNameFlat)
+		l.Warnw("[cachedEntries]", "err", err, "summary", "malformed units cache, repopulating")
+		err = invalidateUnitsCache()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		return nil
 	}
+	return nil, fmt.Errorf("failed to repopulate units cache")
+}
 
-	err = ensureUnitsCache(ctx)
-	if err != nil {
-		return err
+func decodeEntries(rawEntries []string) ([]entry, error) {
+	var result []entry
+	for _, raw := range rawEntries {
+		var e entry
+		err := jsoniter.Unmarshal([]byte(raw), &e)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, e)
 	}
+	return result, nil
+}
 
-	var entries []string
-	var redisKey string
-	if ctx.Bool("flat") {
-		redisKey = redisKeyNameFlat
+func perform(ctx *cli.Context) error {
+	var err error
+	if ctx.Bool("invalidate-cache") {
+		err := systemd.DaemonReload()
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			return nil
+		}
+		return invalidateUnitsCache()
+	}
+
+	var items []ui.Item
+	if r == nil {
+		items, err = collectEntries(ctx.Bool("flat"))
 	} else {
-		redisKey = redisKeyName
+		items, err = cachedEntries(ctx)
+	}
+	if err != nil {
+		return err
 	}
-	entries, _ = r.GetList(redisKey, 0, -1)
 	xkb.EnsureEnglishKeyboardLayout()
-	entry, err := ui.GetSelection(entries, "select", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	selection, err := ui.GetMultiSelection(items, "select", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
 	if err != nil {
 		return err
 	}
+	return performSelected(ctx, selection)
+}
+
+// performSelected asks for operation, unless selected entries already have one, and applies it to selected units
+func performSelected(ctx *cli.Context, selection []ui.Item) error {
+	l := logger.Sugar()
 	xkb.EnsureEnglishKeyboardLayout()
-	var operation string
-	var unit systemd.Unit
+	l.Debugw("[performSelected]", "selected", len(selection))
+	var selected []entry
+	for _, item := range selection {
+		e, ok := item.Value.(entry)
+		if !ok {
+			return fmt.Errorf("no unit found for '%s'", item.Display)
+		}
+		selected = append(selected, e)
+	}
 
-	if ctx.Bool("flat") {
-		entryChunks := strings.Split(entry, "/")
-		// FIXME: ensure sort order
-		unit = systemd.UnitFromString(strings.Trim(entryChunks[0], " "))
-		operation = strings.Trim(entryChunks[1], " ")
-	} else {
-		unit = systemd.UnitFromString(entry)
+	// NOTE: entries with no operation (i.e. the non-flat mode ones) get the same operation applied
+	var operation string
+	if slices.ContainsFunc(selected, func(e entry) bool { return e.Operation == "" }) {
+		operations := OPERATIONS
+		if !slices.ContainsFunc(selected, func(e entry) bool { return !isTimer(e.Unit()) }) {
+			operations = operationsFor(selected[0].Unit())
+		}
 		// FIXME: ensure sort order
-		operation, err = ui.GetSelection(OPERATIONS, "perform", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+		opSelection, err := ui.GetSelection(ui.Items(operations), "perform", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
 		if err != nil {
 			return err
 		}
+		operation = opSelection.Display
 	}
+	for _, e := range selected {
+		op := operation
+		if e.Operation != "" {
+			op = e.Operation
+		}
+		err := performOperation(ctx, e.Unit(), op)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// notifyFailure shows error notification, offering to look into unit journal right away
+func notifyFailure(ctx *cli.Context, unit systemd.Unit, text string) {
+	l := logger.Sugar()
+	_, err := ui.NotifyWithActions("[services]", text, notify.UrgencyCritical, failureNotificationTimeout,
+		notify.Action{
+			Key:   "journal",
+			Label: "Show journal",
+			Callback: func() error {
+				return unit.ShowJournal(shell.TermTraitsFromContext(ctx), false, ctx.Bool(systemd.DumpCmdFlagName))
+			},
+		})
+	if err != nil {
+		l.Warnw("[notifyFailure]", "unit", unit.Name, "err", err)
+	}
+}
+
+func notificationTag(unit systemd.Unit) string {
+	return "services/" + unit.String()
+}
+
+// waitOptions makes slow operations tell user to wait a bit more
+func waitOptions(ctx *cli.Context, unit systemd.Unit, operation string) systemd.WaitOptions {
+	return systemd.WaitOptions{
+		Timeout:   ctx.Duration(operationTimeoutFlagName),
+		SlowAfter: ctx.Duration(stillWaitingAfterFlagName),
+		OnSlow: func(elapsed time.Duration) {
+			ui.NotifyTagged(notificationTag(unit), fmt.Sprintf("[services :: %s]", operation),
+				fmt.Sprintf("%s\n\nstill waiting (%s)...", unit.Name, elapsed.Round(time.Second)), notify.UrgencyNormal)
+		},
+	}
+}
+
+func performOperation(ctx *cli.Context, unit systemd.Unit, operation string) error {
+	var err error
+	l := logger.Sugar()
 	switch operation {
 	case "stop":
-		err = unit.Stop()
+		err = unit.StopAndWait(waitOptions(ctx, unit, operation))
 		if err != nil {
 			l.Errorw("[perform]", "err", err)
-			ui.NotifyCritical("[services]", fmt.Sprintf("Error stopping `%s`:\n\n%s", unit.Name, err.Error()))
+			notifyFailure(ctx, unit, fmt.Sprintf("Error stopping `%s`:\n\n%s", unit.Name, err.Error()))
 			return err
 		}
 	case "kill":
 		err = unit.Kill()
 		if err != nil {
 			l.Errorw("[perform]", "err", err)
-			ui.NotifyCritical("[services]", fmt.Sprintf("Error killing `%s`:\n\n%s", unit.Name, err.Error()))
+			notifyFailure(ctx, unit, fmt.Sprintf("Error killing `%s`:\n\n%s", unit.Name, err.Error()))
 			return err
 		}
 	case "stop/follow":
-		err = unit.Stop()
+		err = unit.StopAndWait(waitOptions(ctx, unit, operation))
 		if err != nil {
 			l.Errorw("[perform]", "err", err)
-			ui.NotifyCritical("[services]", fmt.Sprintf("Error stopping `%s`:\n\n%s", unit.Name, err.Error()))
+			notifyFailure(ctx, unit, fmt.Sprintf("Error stopping `%s`:\n\n%s", unit.Name, err.Error()))
 			return err
 		}
 		err = unit.ShowJournal(shell.TermTraitsFromContext(ctx), true, ctx.Bool(systemd.DumpCmdFlagName))
 		if err != nil {
 			l.Errorw("[perform]", "err", err)
-			ui.NotifyCritical("[services]", fmt.Sprintf("Error following journal for `%s`:\n\n%s", unit.Name, err.Error()))
+			notifyFailure(ctx, unit, fmt.Sprintf("Error following journal for `%s`:\n\n%s", unit.Name, err.Error()))
 			return err
 		}
 	case "restart":
-		err = unit.Restart()
+		err = unit.RestartAndWait(waitOptions(ctx, unit, operation))
 		if err != nil {
 			l.Errorw("[perform]", "err", err)
-			ui.NotifyCritical("[services]", fmt.Sprintf("Error restarting `%s`:\n\n%s", unit.Name, err.Error()))
+			notifyFailure(ctx, unit, fmt.Sprintf("Error restarting `%s`:\n\n%s", unit.Name, err.Error()))
 			return err
 		}
 	case "restart/follow":
-		err = unit.Restart()
+		err = unit.RestartAndWait(waitOptions(ctx, unit, operation))
 		if err != nil {
 			l.Errorw("[perform]", "err", err)
-			ui.NotifyCritical("[services]", fmt.Sprintf("Error restarting `%s`:\n\n%s", unit.Name, err.Error()))
+			notifyFailure(ctx, unit, fmt.Sprintf("Error restarting `%s`:\n\n%s", unit.Name, err.Error()))
 			return err
 		}
 		err = unit.ShowJournal(shell.TermTraitsFromContext(ctx), true, ctx.Bool(systemd.DumpCmdFlagName))
 		if err != nil {
 			l.Errorw("[perform]", "err", err)
-			ui.NotifyCritical("[services]", fmt.Sprintf("Error following journal for `%s`:\n\n%s", unit.Name, err.Error()))
+			notifyFailure(ctx, unit, fmt.Sprintf("Error following journal for `%s`:\n\n%s", unit.Name, err.Error()))
 			return err
 		}
 	case "show":
 		err = unit.Show(shell.TermTraitsFromContext(ctx), ctx.Bool(systemd.DumpCmdFlagName))
 		if err != nil {
 			l.Errorw("[perform]", "err", err)
-			ui.NotifyCritical("[services]", fmt.Sprintf("Error showing `%s`:\n\n%s", unit.Name, err.Error()))
+			notifyFailure(ctx, unit, fmt.Sprintf("Error showing `%s`:\n\n%s", unit.Name, err.Error()))
 			return err
 		}
 	case "journal":
 		err = unit.ShowJournal(shell.TermTraitsFromContext(ctx), false, ctx.Bool(systemd.DumpCmdFlagName))
 		if err != nil {
 			l.Errorw("[perform]", "err", err)
-			ui.NotifyCritical("[services]", fmt.Sprintf("Error showing journal for `%s`:\n\n%s", unit.Name, err.Error()))
+			notifyFailure(ctx, unit, fmt.Sprintf("Error showing journal for `%s`:\n\n%s", unit.Name, err.Error()))
 			return err
 		}
 	case "journal/follow":
 		err = unit.ShowJournal(shell.TermTraitsFromContext(ctx), true, ctx.Bool(systemd.DumpCmdFlagName))
 		if err != nil {
 			l.Errorw("[perform]", "err", err)
-			ui.NotifyCritical("[services]", fmt.Sprintf("Error following journal for `%s`:\n\n%s", unit.Name, err.Error()))
+			notifyFailure(ctx, unit, fmt.Sprintf("Error following journal for `%s`:\n\n%s", unit.Name, err.Error()))
 			return err
 		}
 	case "status":
 		err = unit.ShowStatus(shell.TermTraitsFromContext(ctx), ctx.Bool(systemd.DumpCmdFlagName))
 		if err != nil {
 			l.Errorw("[perform]", "err", err)
-			ui.NotifyCritical("[services]", fmt.Sprintf("Error showing status for `%s`:\n\n%s", unit.Name, err.Error()))
+			notifyFailure(ctx, unit, fmt.Sprintf("Error showing status for `%s`:\n\n%s", unit.Name, err.Error()))
+			return err
+		}
+	case "journal/view":
+		err = showJournal(ctx, unit, operation, false)
+		if err != nil {
+			l.Errorw("[perform]", "err", err)
+			notifyFailure(ctx, unit, fmt.Sprintf("Error reading journal for `%s`:\n\n%s", unit.Name, err.Error()))
+			return err
+		}
+	case "journal/errors":
+		err = showJournal(ctx, unit, operation, true)
+		if err != nil {
+			l.Errorw("[perform]", "err", err)
+			notifyFailure(ctx, unit, fmt.Sprintf("Error reading journal for `%s`:\n\n%s", unit.Name, err.Error()))
+			return err
+		}
+	case "trigger now":
+		var timer *systemd.Timer
+		timer, err = unit.Timer()
+		if err == nil {
+			err = timer.Trigger(waitOptions(ctx, timer.TriggeredUnit(), operation))
+		}
+		if err != nil {
+			l.Errorw("[perform]", "err", err)
+			notifyFailure(ctx, unit, fmt.Sprintf("Error triggering `%s`:\n\n%s", unit.Name, err.Error()))
 			return err
 		}
 	}
-	ui.NotifyNormal(fmt.Sprintf("[services :: %s]", operation), unit.Name)
+	ui.NotifyTagged(notificationTag(unit), fmt.Sprintf("[services :: %s]", operation), unit.Name, notify.UrgencyNormal)
 
 	return nil
 }
 
+// journalQuery makes journal query out of command line flags, errorsOnly overrides them with errors since last boot
+// NOTE: flags are looked up through contexts lineage, so that outside of `journal` command query is just unfiltered
+func journalQuery(ctx *cli.Context, errorsOnly bool) (systemd.JournalQuery, error) {
+	if errorsOnly {
+		return systemd.JournalQuery{Priority: systemd.JournalPriorityErrors, ThisBoot: true}, nil
+	}
+	result := systemd.JournalQuery{
+		Priority: ctx.String(journalPriorityFlagName),
+		Since:    ctx.String(journalSinceFlagName),
+		Until:    ctx.String(journalUntilFlagName),
+		ThisBoot: ctx.Bool(journalBootFlagName),
+		Lines:    ctx.Int(journalLinesFlagName),
+	}
+	if pattern := ctx.String(journalGrepFlagName); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return result, err
+		}
+		result.Grep = re
+	}
+	return result, nil
+}
+
+// showJournal reads unit's journal and shows it in dialog window, or copies it to clipboard
+func showJournal(ctx *cli.Context, unit systemd.Unit, operation string, errorsOnly bool) error {
+	q, err := journalQuery(ctx, errorsOnly)
+	if err != nil {
+		return err
+	}
+	if ctx.Bool(systemd.DumpCmdFlagName) {
+		cmd := unit.JournalCmd(q)
+		return xserver.WriteClipboard(&cmd, false)
+	}
+	entries, err := unit.Journal(q)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		ui.NotifyNormal(fmt.Sprintf("[services :: %s]", operation), fmt.Sprintf("%s\n\nno matching journal entries", unit.Name))
+		return nil
+	}
+	text := systemd.JournalAsText(entries)
+	if ctx.Bool(journalClipboardFlagName) {
+		return xserver.WriteClipboard(&text, false)
+	}
+	return ui.ShowTextDialog(text, fmt.Sprintf("%s :: %s", operation, unit.String()))
+}
+
+func journal(ctx *cli.Context) error {
+	// NOTE: failing early, rather than after units have been selected
+	_, err := journalQuery(ctx, ctx.Bool("errors"))
+	if err != nil {
+		return err
+	}
+	var items []ui.Item
+	if r == nil {
+		items, err = collectEntries(false)
+	} else {
+		items, err = cachedEntries(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	xkb.EnsureEnglishKeyboardLayout()
+	selection, err := ui.GetMultiSelection(items, "journal", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	if err != nil {
+		return err
+	}
+	operation := "journal/view"
+	if ctx.Bool("errors") {
+		operation = "journal/errors"
+	}
+	for _, item := range selection {
+		e, ok := item.Value.(entry)
+		if !ok {
+			return fmt.Errorf("no unit found for '%s'", item.Display)
+		}
+		err = performOperation(ctx, e.Unit(), operation)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyUnitFailed tells about unit failure, which happened in background, offering to either restart unit or look into
+// its journal
+// NOTE: notifications with actions are shown one at a time, so the timeout keeps subsequent failures from piling up
+func notifyUnitFailed(ctx *cli.Context, unit systemd.Unit, failure systemd.Failure) {
+	l := logger.Sugar()
+	text := fmt.Sprintf("`%s` has failed (%s) at %s", unit.String(), failure.SubState,
+		time.Unix(failure.Time, 0).Format(time.TimeOnly))
+	_, err := ui.NotifyWithActions("[services :: watch]", text, notify.UrgencyCritical, watchNotificationTimeout,
+		notify.Action{
+			Key:   "restart",
+			Label: "Restart",
+			Callback: func() error {
+				return performOperation(ctx, unit, "restart")
+			},
+		},
+		notify.Action{
+			Key:   "journal",
+			Label: "Show journal",
+			Callback: func() error {
+				return performOperation(ctx, unit, "journal")
+			},
+		})
+	if err != nil {
+		l.Warnw("[notifyUnitFailed]", "unit", unit.String(), "err", err)
+	}
+}
+
+func watch(ctx *cli.Context) error {
+	l := logger.Sugar()
+	buses := ctx.StringSlice("bus")
+	changes, errs, err := systemd.WatchStates(context.Background(),
+		slices.Contains(buses, "system"), slices.Contains(buses, "user"))
+	if err != nil {
+		return err
+	}
+	failures := make(chan systemd.Failure, 16)
+	go func() {
+		for f := range failures {
+			notifyUnitFailed(ctx, f.Unit(), f)
+		}
+	}()
+	// NOTE: systemd reports the same state several times during single transition, so only transitions into failed
+	// state are taken into account
+	states := make(map[string]string)
+	for {
+		select {
+		case change := <-changes:
+			key := change.Unit.String()
+			previous := states[key]
+			states[key] = change.ActiveState
+			if change.ActiveState != systemd.ActiveStateFailed || previous == systemd.ActiveStateFailed {
+				continue
+			}
+			l.Infow("[watch]", "unit", key, "sub", change.SubState)
+			failure := systemd.Failure{
+				Name:     change.Name,
+				User:     change.User,
+				SubState: change.SubState,
+				Time:     change.Time.Unix(),
+			}
+			if r != nil {
+				err = systemd.RecordFailure(failure)
+				if err != nil {
+					l.Warnw("[watch]", "unit", key, "err", err)
+				}
+			}
+			// NOTE: notifications are shown one at a time, so failure bursts are dropped rather than stalling the watch,
+			// they are still recorded, if store is available, see `failed`
+			select {
+			case failures <- failure:
+			default:
+				l.Warnw("[watch]", "unit", key, "summary", "too many pending failure notifications, dropping")
+			}
+		case err := <-errs:
+			l.Warnw("[watch]", "err", err)
+		}
+	}
+}
+
+func recentlyFailed(ctx *cli.Context) error {
+	if r == nil {
+		return rErr
+	}
+	failures, err := systemd.RecentFailures()
+	if err != nil {
+		return err
+	}
+	// NOTE: the same unit could fail several times, the most recent failure is what matters
+	seen := make(map[string]bool)
+	var items []ui.Item
+	for _, f := range failures {
+		e := entry{Name: f.Name, User: f.User}
+		if seen[e.String()] {
+			continue
+		}
+		seen[e.String()] = true
+		items = append(items, ui.Item{
+			Display: fmt.Sprintf("%s / %s %s", e.String(), time.Unix(f.Time, 0).Format(time.DateTime), f.SubState),
+			Value:   e,
+		})
+	}
+	if len(items) == 0 {
+		ui.NotifyNormal("[services]", "no units have failed recently")
+		return nil
+	}
+	xkb.EnsureEnglishKeyboardLayout()
+	selection, err := ui.GetMultiSelection(items, "failed", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	if err != nil {
+		return err
+	}
+	return performSelected(ctx, selection)
+}
+
+// formatElapse renders timer's elapse time along with its distance from now, zero time means "never"
+func formatElapse(t time.Time) string {
+	if t.IsZero() {
+		return "n/a"
+	}
+	distance := time.Until(t).Round(time.Second)
+	if distance < 0 {
+		return fmt.Sprintf("%s (%s ago)", t.Format(time.DateTime), -distance)
+	}
+	return fmt.Sprintf("%s (in %s)", t.Format(time.DateTime), distance)
+}
+
+func timerToItem(t systemd.Timer) ui.Item {
+	result := t.LastResult
+	if result == "" {
+		result = "n/a"
+	}
+	return ui.Item{
+		Display: fmt.Sprintf("%s / next: %s / last: %s / %s: %s", t.Unit.String(),
+			formatElapse(t.NextElapse), formatElapse(t.LastTrigger), t.Triggers, result),
+		Value: t,
+	}
+}
+
+func timers(ctx *cli.Context) error {
+	l := logger.Sugar()
+	buses := ctx.StringSlice("bus")
+	timers, err := systemd.ListTimers(slices.Contains(buses, "system"), slices.Contains(buses, "user"))
+	if err != nil {
+		return err
+	}
+	if ctx.Bool("print") {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIMER\tNEXT\tLAST\tUNIT\tRESULT")
+		for _, t := range timers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.Unit.String(),
+				formatElapse(t.NextElapse), formatElapse(t.LastTrigger), t.Triggers, t.LastResult)
+		}
+		return w.Flush()
+	}
+	if len(timers) == 0 {
+		ui.NotifyNormal("[services]", "no timers found")
+		return nil
+	}
+	var items []ui.Item
+	for _, t := range timers {
+		items = append(items, timerToItem(t))
+	}
+	xkb.EnsureEnglishKeyboardLayout()
+	selection, err := ui.GetMultiSelection(items, "timers", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	if err != nil {
+		return err
+	}
+	opSelection, err := ui.GetSelection(ui.Items(TIMER_OPERATIONS), "perform", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	if err != nil {
+		return err
+	}
+	for _, item := range selection {
+		t, ok := item.Value.(systemd.Timer)
+		if !ok {
+			return fmt.Errorf("no timer found for '%s'", item.Display)
+		}
+		unit := t.Unit
+		if strings.HasPrefix(opSelection.Display, "journal") && t.Triggers != "" {
+			unit = t.TriggeredUnit()
+		}
+		l.Debugw("[timers]", "timer", t.Unit.String(), "unit", unit.String(), "operation", opSelection.Display)
+		err = performOperation(ctx, unit, opSelection.Display)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func install(ctx *cli.Context) error {
+	l := logger.Sugar()
+	if ctx.Args().Len() == 0 {
+		return fmt.Errorf("no command to install, pass it after `--`, e.g. `services install -s hourly -- ffsessions rotate`")
+	}
+	spec := systemd.UnitSpec{
+		Name:        ctx.String("name"),
+		Description: ctx.String("description"),
+		Command:     ctx.Args().Slice(),
+		Schedule:    ctx.String("schedule"),
+		Environment: ctx.StringSlice("env"),
+	}
+	if ctx.Bool("pass-env") {
+		spec.Environment = append(systemd.PassEnvironment(), spec.Environment...)
+	}
+	var unit *systemd.Unit
+	var err error
+	if ctx.Bool("transient") {
+		unit, err = systemd.RunTransient(spec)
+	} else {
+		unit, err = systemd.Install(spec)
+	}
+	if err != nil {
+		return err
+	}
+	l.Infow("[install]", "unit", unit.String(), "schedule", spec.Schedule)
+	if r != nil {
+		// NOTE: new units should show up in selector right away
+		err = invalidateUnitsCache()
+		if err != nil {
+			l.Warnw("[install]", "err", err)
+		}
+	}
+	ui.NotifyNormal("[services :: install]", unit.String())
+	return nil
+}
+
+func generatedToItems(units []systemd.GeneratedUnit) []ui.Item {
+	var result []ui.Item
+	for _, u := range units {
+		kind := "transient"
+		if !u.Transient() {
+			kind = u.Path
+		}
+		result = append(result, ui.Item{Display: fmt.Sprintf("%s / %s", u.Unit.String(), kind), Value: u})
+	}
+	return result
+}
+
+func installed(ctx *cli.Context) error {
+	units, err := systemd.ListGenerated()
+	if err != nil {
+		return err
+	}
+	for _, item := range generatedToItems(units) {
+		fmt.Println(item.Display)
+	}
+	return nil
+}
+
+func uninstall(ctx *cli.Context) error {
+	l := logger.Sugar()
+	units, err := systemd.ListGenerated()
+	if err != nil {
+		return err
+	}
+	var selected []systemd.GeneratedUnit
+	if ctx.Args().Len() > 0 {
+		for _, name := range ctx.Args().Slice() {
+			idx := slices.IndexFunc(units, func(u systemd.GeneratedUnit) bool {
+				return u.Name == name || strings.TrimSuffix(u.Name, filepath.Ext(u.Name)) == name
+			})
+			if idx == -1 {
+				return systemd.ErrNotGenerated{Name: name}
+			}
+			selected = append(selected, units[idx])
+		}
+	} else {
+		if len(units) == 0 {
+			ui.NotifyNormal("[services]", "no generated units found")
+			return nil
+		}
+		xkb.EnsureEnglishKeyboardLayout()
+		selection, err := ui.GetMultiSelection(generatedToItems(units), "uninstall", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+		if err != nil {
+			return err
+		}
+		for _, item := range selection {
+			u, ok := item.Value.(systemd.GeneratedUnit)
+			if !ok {
+				return fmt.Errorf("no unit found for '%s'", item.Display)
+			}
+			selected = append(selected, u)
+		}
+	}
+	for _, u := range selected {
+		err = systemd.Uninstall(u)
+		if err != nil {
+			return err
+		}
+		l.Infow("[uninstall]", "unit", u.Unit.String())
+		ui.NotifyNormal("[services :: uninstall]", u.Unit.String())
+	}
+	if r != nil {
+		return invalidateUnitsCache()
+	}
+	return nil
+}
+
+func connect(ctx *cli.Context) error {
+	l := logger.Sugar()
+	err := store.ConfigureFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	r, err = store.Shared()
+	if store.IsUnavailable(err) {
+		l.Warnw("[connect]", "err", err, "summary", "units cache is unavailable, collecting units directly")
+		r, rErr = nil, err
+		return nil
+	}
+	return err
+}
+
 func createCLI() *cli.App {
 	app := cli.NewApp()
 	app.Name = "Services"
@@ -230,6 +864,20 @@ func createCLI() *cli.App {
 			Usage:    "Do nothing, copy systemd CLI command to clipboard instead",
 			Required: false,
 		},
+		&cli.DurationFlag{
+			Name:     operationTimeoutFlagName,
+			EnvVars:  []string{impl.EnvPrefix + "_SERVICES_TIMEOUT"},
+			Value:    operationTimeoutDefault,
+			Usage:    "How long to wait for stopping or restarting unit",
+			Required: false,
+		},
+		&cli.DurationFlag{
+			Name:     stillWaitingAfterFlagName,
+			EnvVars:  []string{impl.EnvPrefix + "_SERVICES_STILL_WAITING_AFTER"},
+			Value:    stillWaitingAfterDefault,
+			Usage:    "Notify that operation is still in progress that often",
+			Required: false,
+		},
 		&cli.StringFlag{
 			Name:     tmux.SessionFlagName,
 			Aliases:  []string{"t"},
@@ -259,29 +907,182 @@ func createCLI() *cli.App {
 			Usage:    "Terminal command to use",
 			Required: false,
 		},
+		&cli.BoolFlag{
+			Name:     shell.TerminalHoldFlagName,
+			EnvVars:  []string{impl.EnvPrefix + "_TERMINAL_HOLD"},
+			Usage:    "Keep terminal open after command exits, regardless of command kind",
+			Required: false,
+		},
 		&cli.StringFlag{
 			Name:     shell.TerminalBackendFlagName,
 			EnvVars:  []string{impl.EnvPrefix + "_TERMINAL_BACKEND"},
 			Value:    shell.TerminalBackendDefault,
-			Usage:    "Terminal backend to use",
+			Usage:    "Terminal backend to use, e.g. kitty, alacritty, wezterm, foot, tmux, tmux-split, zellij",
 			Required: false,
 		},
 	}
+	app.Flags = append(app.Flags, store.CLIFlags()...)
+	app.Flags = append(app.Flags, ui.HistoryCLIFlags()...)
+	app.Before = ui.WithHistory(connect)
 	app.Action = perform
+	app.Commands = cli.Commands{
+		{
+			Name:   "watch",
+			Usage:  "Watch units in background, notifying about failed ones",
+			Action: watch,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:     "bus",
+					Aliases:  []string{"b"},
+					Value:    cli.NewStringSlice("system", "user"),
+					Usage:    "Managers to watch units of, either system or user one, or both",
+					Required: false,
+				},
+			},
+		},
+		{
+			Name:   "timers",
+			Usage:  "Select from timers, sorted by next run",
+			Action: timers,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:     "bus",
+					Aliases:  []string{"b"},
+					Value:    cli.NewStringSlice("system", "user"),
+					Usage:    "Managers to list timers of, either system or user one, or both",
+					Required: false,
+				},
+				&cli.BoolFlag{
+					Name:     "print",
+					Aliases:  []string{"p"},
+					Usage:    "Print timers table to stdout instead of selecting",
+					Required: false,
+				},
+			},
+		},
+		{
+			Name:   "journal",
+			Usage:  "Read journal of selected units, with optional filtering",
+			Action: journal,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     journalPriorityFlagName,
+					Aliases:  []string{"p"},
+					Usage:    "Priority or priorities range to show, e.g. \"err\" or \"warning..err\"",
+					Required: false,
+				},
+				&cli.StringFlag{
+					Name:     journalSinceFlagName,
+					Aliases:  []string{"S"},
+					Usage:    "Show entries not older than that, in journalctl format, e.g. \"-1h\" or \"today\"",
+					Required: false,
+				},
+				&cli.StringFlag{
+					Name:     journalUntilFlagName,
+					Aliases:  []string{"U"},
+					Usage:    "Show entries not newer than that, in journalctl format",
+					Required: false,
+				},
+				&cli.StringFlag{
+					Name:     journalGrepFlagName,
+					Aliases:  []string{"g"},
+					Usage:    "Show only entries with messages matching regexp",
+					Required: false,
+				},
+				&cli.IntFlag{
+					Name:     journalLinesFlagName,
+					Aliases:  []string{"n"},
+					Usage:    "Show that many most recent entries, negative value means no limit",
+					Required: false,
+				},
+				&cli.BoolFlag{
+					Name:     journalBootFlagName,
+					Aliases:  []string{"b"},
+					Usage:    "Show entries since last boot only",
+					Required: false,
+				},
+				&cli.BoolFlag{
+					Name:     "errors",
+					Aliases:  []string{"e"},
+					Usage:    "Show errors since last boot, ignoring other filters",
+					Required: false,
+				},
+				&cli.BoolFlag{
+					Name:     journalClipboardFlagName,
+					Aliases:  []string{"c"},
+					Usage:    "Copy journal to clipboard instead of showing it",
+					Required: false,
+				},
+			},
+		},
+		{
+			Name:      "install",
+			Usage:     "Run toolbox command periodically or as a daemon, under user manager",
+			ArgsUsage: "-- command [args...]",
+			Action:    install,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "schedule",
+					Aliases:  []string{"s"},
+					Usage:    "OnCalendar expression, e.g. \"hourly\", command is run as a daemon if omitted",
+					Required: false,
+				},
+				&cli.StringFlag{
+					Name:     "name",
+					Aliases:  []string{"n"},
+					Usage:    "Unit name of letters, digits, '_' and '-', derived from command if omitted, e.g. \"tb-ffsessions-rotate\"",
+					Required: false,
+				},
+				&cli.StringFlag{
+					Name:     "description",
+					Usage:    "Unit description",
+					Required: false,
+				},
+				&cli.StringSliceFlag{
+					Name:     "env",
+					Aliases:  []string{"e"},
+					Usage:    "Environment variable to set for command, as KEY=VALUE",
+					Required: false,
+				},
+				&cli.BoolFlag{
+					Name:     "pass-env",
+					Aliases:  []string{"E"},
+					Usage:    "Pass toolbox settings from current environment to command",
+					Required: false,
+				},
+				&cli.BoolFlag{
+					Name:     "transient",
+					Usage:    "Run transient unit with systemd-run instead of writing unit files, it is gone after reboot",
+					Required: false,
+				},
+			},
+		},
+		{
+			Name:   "installed",
+			Usage:  "List units created by install",
+			Action: installed,
+		},
+		{
+			Name:      "uninstall",
+			Usage:     "Stop and remove units created by install, selecting them unless names are provided",
+			ArgsUsage: "[unit name...]",
+			Action:    uninstall,
+		},
+		{
+			Name:   "failed",
+			Usage:  "Select from recently failed units",
+			Action: recentlyFailed,
+		},
+	}
 	return app
 }
 
 func main() {
-	var err error
 	logger = impl.NewLogger()
 	defer logger.Sync()
 	l := logger.Sugar()
-	r, err = redis.NewRedisLocal()
-	if err != nil {
-		l.Errorw("[main]", "err", err)
-	}
 	app := createCLI()
-	err = app.Run(os.Args)
+	err := app.Run(os.Args)
 	if err != nil {
 		l.Errorw("[main]", "err", err)
 	}
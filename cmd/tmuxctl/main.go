@@ -1,11 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"slices"
 	"sort"
+	"strings"
 
 	"github.com/urfave/cli/v2"
 	"github.com/wiedzmin/toolbox/impl"
+	"github.com/wiedzmin/toolbox/impl/fs"
+	"github.com/wiedzmin/toolbox/impl/shell"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
+	"github.com/wiedzmin/toolbox/impl/shell/tmux"
 	"github.com/wiedzmin/toolbox/impl/shell/tmux/tmuxp"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"github.com/wiedzmin/toolbox/impl/xserver/xkb"
@@ -14,34 +21,381 @@ import (
 
 var logger *zap.Logger
 
-func perform(ctx *cli.Context) error {
-	sessions, err := tmuxp.CollectSessions(tmuxp.SessionsRootDefault())
+const (
+	stateRunning  = "running"
+	stateAttached = "attached"
+	stateDefined  = "tmuxp"
+)
+
+type ErrNoSessions struct{}
+
+func (e ErrNoSessions) Error() string {
+	return "no sessions found, neither running nor defined"
+}
+
+type ErrSnapshotExists struct {
+	Paths []string
+}
+
+func (e ErrSnapshotExists) Error() string {
+	return fmt.Sprintf("configurations already exist, use --force to overwrite them: '%s'", strings.Join(e.Paths, "', '"))
+}
+
+// sessionEntry joins running session with tmuxp definition of the same name, either of them could be missing
+type sessionEntry struct {
+	Name    string
+	Running *tmux.Session
+	Defined *tmuxp.Session
+}
+
+func (e sessionEntry) states() []string {
+	var result []string
+	if e.Running != nil {
+		result = append(result, stateRunning)
+		if e.Running.Attached {
+			result = append(result, stateAttached)
+		}
+	}
+	if e.Defined != nil {
+		result = append(result, stateDefined)
+	}
+	return result
+}
+
+// collectEntries merges running sessions and tmuxp definitions, the latter are skipped if runningOnly is set
+func collectEntries(root string, runningOnly bool) ([]sessionEntry, error) {
+	l := logger.Sugar()
+	entries := make(map[string]*sessionEntry)
+	entry := func(name string) *sessionEntry {
+		if _, ok := entries[name]; !ok {
+			entries[name] = &sessionEntry{Name: name}
+		}
+		return entries[name]
+	}
+	running, err := tmux.ListSessions()
+	if _, ok := err.(tmux.ErrServerNotRunning); ok {
+		l.Debugw("[collectEntries]", "summary", "tmux server is not running")
+	} else if err != nil {
+		return nil, err
+	}
+	for i := range running {
+		entry(running[i].Name).Running = &running[i]
+	}
+	if !runningOnly {
+		defined, err := tmuxp.CollectSessions(root)
+		if err != nil {
+			return nil, err
+		}
+		for i := range defined {
+			entry(defined[i].Name).Defined = &defined[i]
+		}
+	}
+	var result []sessionEntry
+	for _, e := range entries {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func entriesToItems(entries []sessionEntry) []ui.Item {
+	var result []ui.Item
+	for _, e := range entries {
+		states := strings.Join(e.states(), ", ")
+		result = append(result, ui.Item{
+			Display: fmt.Sprintf("%s [%s]", e.Name, states),
+			Value:   e,
+			Meta:    states,
+		})
+	}
+	return result
+}
+
+func selectEntries(ctx *cli.Context, prompt string, runningOnly, multiple bool) ([]sessionEntry, error) {
+	entries, err := collectEntries(ctx.String("root"), runningOnly)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrNoSessions{}
+	}
+	xkb.EnsureEnglishKeyboardLayout()
+	var selection []ui.Item
+	if multiple {
+		selection, err = ui.GetMultiSelection(entriesToItems(entries), prompt, ctx.String(ui.SelectorToolFlagName),
+			ctx.String(impl.SelectorFontFlagName), true, false)
+	} else {
+		var item *ui.Item
+		item, err = ui.GetSelection(entriesToItems(entries), prompt, ctx.String(ui.SelectorToolFlagName),
+			ctx.String(impl.SelectorFontFlagName), true, false)
+		if item != nil {
+			selection = append(selection, *item)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result []sessionEntry
+	for _, item := range selection {
+		e, ok := item.Value.(sessionEntry)
+		if !ok {
+			return nil, tmux.ErrSessionNotFound{Name: item.Display}
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+// load starts session from its tmuxp definition, validating the latter first
+func load(e sessionEntry) (*tmux.Session, error) {
+	if e.Defined == nil {
+		return nil, tmuxp.ErrSessionNotFound{Name: e.Name}
+	}
+	_, err := tmuxp.LoadConfig(e.Defined.Path)
+	if err != nil {
+		ui.NotifyCritical("[tmuxctl]", err.Error())
+		return nil, err
+	}
+	err = e.Defined.Load(false)
+	if err != nil {
+		return nil, err
+	}
+	return tmux.GetSession(e.Name, false, false)
+}
+
+func loadOrSwitch(ctx *cli.Context) error {
+	l := logger.Sugar()
+	selection, err := selectEntries(ctx, "load", false, false)
+	if err != nil {
+		return err
+	}
+	e := selection[0]
+	if e.Running != nil {
+		return e.Running.Switch()
+	}
+	session, err := load(e)
 	if err != nil {
 		return err
 	}
-	sessionsByName := make(map[string]tmuxp.Session)
-	var names []string
+	// NOTE: there could be no tmux clients at all, which is fine, session is just left detached then
+	err = session.Switch()
+	if err != nil {
+		l.Debugw("[loadOrSwitch]", "session", e.Name, "summary", "could not switch to loaded session", "err", err)
+	}
+	return nil
+}
+
+func switchSession(ctx *cli.Context) error {
+	selection, err := selectEntries(ctx, "switch", true, false)
+	if err != nil {
+		return err
+	}
+	return selection[0].Running.Switch()
+}
+
+func kill(ctx *cli.Context) error {
+	l := logger.Sugar()
+	selection, err := selectEntries(ctx, "kill", true, true)
+	if err != nil {
+		return err
+	}
+	for _, e := range selection {
+		l.Debugw("[kill]", "session", e.Name)
+		err = e.Running.Kill()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func attach(ctx *cli.Context) error {
+	l := logger.Sugar()
+	selection, err := selectEntries(ctx, "attach", false, false)
+	if err != nil {
+		return err
+	}
+	e := selection[0]
+	session := e.Running
+	if session == nil {
+		session, err = load(e)
+		if err != nil {
+			return err
+		}
+	}
+	traits := shell.TermTraitsFromContext(ctx)
+	// NOTE: attaching from within tmux would nest clients, so switching instead
+	if traits.Backend == shell.TerminalBackendTmux || traits.Backend == shell.TerminalBackendTmuxSplit {
+		return session.Switch()
+	}
+	cmd := fmt.Sprintf("tmux attach-session -t %s", proc.QuoteWord("="+session.Name))
+	l.Debugw("[attach]", "session", session.Name, "cmd", cmd, "traits", traits)
+	return shell.RunInTerminal(cmd, session.Name, traits)
+}
+
+func validate(ctx *cli.Context) error {
+	var paths []string
+	if ctx.Args().Present() {
+		for _, arg := range ctx.Args().Slice() {
+			if fs.FileExists(arg) {
+				paths = append(paths, arg)
+				continue
+			}
+			session, err := tmuxp.GetSession(ctx.String("root"), arg)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, session.Path)
+		}
+	} else {
+		sessions, err := tmuxp.CollectSessions(ctx.String("root"))
+		if err != nil {
+			return err
+		}
+		for _, s := range sessions {
+			paths = append(paths, s.Path)
+		}
+	}
+	var invalid int
+	for _, path := range paths {
+		config, err := tmuxp.ReadConfig(path)
+		if err != nil {
+			fmt.Println(err)
+			invalid++
+			continue
+		}
+		problems := config.Validate()
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d session files are invalid", invalid, len(paths))
+	}
+	return nil
+}
+
+func snapshot(ctx *cli.Context) error {
+	l := logger.Sugar()
+	sessions, err := tmux.ListSessions()
+	if err != nil {
+		return err
+	}
+	names := ctx.StringSlice("session")
+	// NOTE: everything is checked before writing anything, so that there are no partial snapshots
+	configs := make(map[string]*tmuxp.Config)
+	var paths, existing []string
 	for _, s := range sessions {
-		names = append(names, s.Name)
-		sessionsByName[s.Name] = s
+		if len(names) > 0 && !slices.Contains(names, s.Name) {
+			continue
+		}
+		config, err := tmuxp.Snapshot(s)
+		if err != nil {
+			return err
+		}
+		path := tmuxp.SessionPath(ctx.String("root"), s.Name)
+		l.Debugw("[snapshot]", "session", s.Name, "path", path)
+		// NOTE: existing configurations are quite often hand-written ones, which snapshot would not reproduce faithfully
+		if fs.FileExists(path) && !ctx.Bool("force") {
+			existing = append(existing, path)
+		}
+		configs[path] = config
+		paths = append(paths, path)
 	}
-	sort.Strings(names)
-	xkb.EnsureEnglishKeyboardLayout()
-	sessionName, err := ui.GetSelection(names, "load", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	if len(existing) > 0 {
+		return ErrSnapshotExists{Paths: existing}
+	}
+	for _, path := range paths {
+		err = configs[path].Write(path)
+		if err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+func restore(ctx *cli.Context) error {
+	l := logger.Sugar()
+	var paths []string
+	names := ctx.StringSlice("session")
+	if len(names) > 0 {
+		for _, name := range names {
+			session, err := tmuxp.GetSession(ctx.String("root"), name)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, session.Path)
+		}
+	} else {
+		sessions, err := tmuxp.CollectSessions(ctx.String("root"))
+		if err != nil {
+			return err
+		}
+		for _, s := range sessions {
+			paths = append(paths, s.Path)
+		}
+	}
+	// NOTE: configurations are validated upfront, so that live sessions are never killed for nothing
+	var configs []*tmuxp.Config
+	var invalid int
+	for _, path := range paths {
+		config, err := tmuxp.LoadConfig(path)
+		if err != nil {
+			l.Warnw("[restore]", "path", path, "err", err)
+			fmt.Println(err)
+			invalid++
+			continue
+		}
+		configs = append(configs, config)
+	}
+	current, err := tmux.CurrentSession()
 	if err != nil {
 		return err
 	}
-	session, ok := sessionsByName[sessionName]
-	if !ok {
-		return tmuxp.ErrSessionNotFound{Name: sessionName}
+	for _, config := range configs {
+		path := config.Path
+		running, err := tmux.HasSession(config.SessionName)
+		if err != nil {
+			return err
+		}
+		l.Debugw("[restore]", "session", config.SessionName, "path", path, "running", running, "current", current)
+		if running {
+			if ctx.Bool("skip-running") {
+				continue
+			}
+			// NOTE: killing current session would kill restore itself, along with whatever user runs there
+			if config.SessionName == current {
+				fmt.Printf("'%s' is the current session, leaving it intact\n", current)
+				continue
+			}
+			session := tmux.Session{Name: config.SessionName}
+			err = session.Kill()
+			if err != nil {
+				return err
+			}
+		}
+		session := tmuxp.Session{Name: config.SessionName, Path: path}
+		err = session.Load(false)
+		if err != nil {
+			return err
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d session files are invalid and were skipped", invalid, len(paths))
 	}
-	return session.Load(false)
+	return nil
 }
 
 func createCLI() *cli.App {
 	app := cli.NewApp()
 	app.Name = "Tmuxctl"
-	app.Usage = "Lists and loads Tmuxp sessions"
+	app.Usage = "Manages tmux sessions, both running and defined with tmuxp"
 	app.Description = "Tmuxctl"
 	app.Version = "0.0.1#master"
 
@@ -61,8 +415,93 @@ func createCLI() *cli.App {
 			Usage:    "Selector tool to use, e.g. dmenu, rofi, etc.",
 			Required: false,
 		},
+		&cli.StringFlag{
+			Name:     "root",
+			Aliases:  []string{"r"},
+			Value:    tmuxp.SessionsRootDefault(),
+			Usage:    "Directory with tmuxp configurations, snapshots are saved there too",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     shell.TerminalCommandFlagName,
+			EnvVars:  []string{impl.EnvPrefix + "_TERMINAL_CMD"},
+			Usage:    "Terminal command to use",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     shell.TerminalBackendFlagName,
+			Aliases:  []string{"t"},
+			EnvVars:  []string{impl.EnvPrefix + "_TERMINAL_BACKEND"},
+			Value:    shell.TerminalBackendDefault,
+			Usage:    "Terminal backend to use, e.g. kitty, alacritty, wezterm, foot, tmux, tmux-split, zellij",
+			Required: false,
+		},
+	}
+	app.Action = loadOrSwitch
+	app.Commands = cli.Commands{
+		{
+			Name:   "load",
+			Usage:  "Load tmuxp session, or switch to it if it is already running",
+			Action: loadOrSwitch,
+		},
+		{
+			Name:   "switch",
+			Usage:  "Switch tmux client to running session",
+			Action: switchSession,
+		},
+		{
+			Name:   "kill",
+			Usage:  "Kill running sessions",
+			Action: kill,
+		},
+		{
+			Name:   "attach",
+			Usage:  "Attach to session in new terminal, loading it first if needed",
+			Action: attach,
+		},
+		{
+			Name:   "snapshot",
+			Usage:  "Save live sessions as tmuxp configurations",
+			Action: snapshot,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:     "session",
+					Aliases:  []string{"s"},
+					Usage:    "Session to save, all running ones are saved if omitted",
+					Required: false,
+				},
+				&cli.BoolFlag{
+					Name:     "force",
+					Usage:    "Overwrite existing configurations",
+					Required: false,
+				},
+			},
+		},
+		{
+			Name:      "validate",
+			Usage:     "Check tmuxp configurations for errors, reporting respective lines",
+			ArgsUsage: "[session name or file...]",
+			Action:    validate,
+		},
+		{
+			Name:   "restore",
+			Usage:  "Recreate sessions from tmuxp configurations, invalid ones are skipped, running ones are killed first",
+			Action: restore,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:     "session",
+					Aliases:  []string{"s"},
+					Usage:    "Session to restore, all configured ones are restored if omitted",
+					Required: false,
+				},
+				&cli.BoolFlag{
+					Name:     "skip-running",
+					Usage:    "Leave already running sessions intact, otherwise they are killed and recreated, losing their state; current session is never killed",
+					Required: false,
+				},
+			},
+		},
 	}
-	app.Action = perform
 	return app
 }
 
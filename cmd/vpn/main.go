@@ -4,10 +4,11 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/urfave/cli/v2"
 	"github.com/wiedzmin/toolbox/impl"
-	"github.com/wiedzmin/toolbox/impl/redis"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"github.com/wiedzmin/toolbox/impl/vpn"
 	"go.uber.org/zap"
@@ -15,28 +16,49 @@ import (
 
 var logger *zap.Logger
 
-func perform(ctx *cli.Context) error {
-	var result []string
-	r, err := redis.NewRedisLocal()
+func formatDuration(s vpn.Status) string {
+	if s.Since == 0 {
+		return "-"
+	}
+	return s.Duration().String()
+}
+
+// showStatus prints statuses table, also showing it as notification, for the case of being run from keybinding
+// Recorded statuses are reconciled with live system beforehand, as they could be stale
+func showStatus(services *vpn.Services) error {
+	lives := services.Reconcile()
+	statuses, err := services.Statuses()
 	if err != nil {
+		ui.NotifyCritical("[VPN]", "Failed to get vpn statuses")
 		return err
 	}
-	if ctx.Bool("status") {
-		statuses, err := r.GetValuesMapFuzzy("vpn/*/is_up")
-		if err == nil {
-			for key, value := range statuses {
-				result = append(result, fmt.Sprintf("%s: %s", strings.Split(key, "/")[1], string(value)))
-			}
-			ui.NotifyNormal("[VPN] statuses", strings.Join(result, "\n"))
-		} else {
-			ui.NotifyCritical("[VPN]", "Failed to get vpn statuses")
+	var lines []string
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tSTATE\tFOR\tLIVE\tLAST ERROR")
+	for _, s := range statuses {
+		details := "unknown"
+		if live, ok := lives[s.Name]; ok {
+			details = live.Details()
 		}
-		return nil
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Name, services.Get(s.Name).Type, s.State, formatDuration(s), details, s.LastError)
+		lines = append(lines, fmt.Sprintf("%s: %s (%s)", s.Name, s.State, formatDuration(s)))
 	}
-	services, err := vpn.ServicesFromRedis("net/vpn_meta")
+	ui.NotifyNormal("[VPN] statuses", strings.Join(lines, "\n"))
+	return w.Flush()
+}
+
+func perform(ctx *cli.Context) error {
+	services, err := vpn.ServicesFromStore("net/vpn_meta")
 	if err != nil {
 		return err
 	}
+	if ctx.Bool("status") {
+		return showStatus(services)
+	}
+	if ctx.Bool("reconcile") {
+		services.Reconcile()
+		return nil
+	}
 	if ctx.Bool("stop-all") {
 		err = services.StopRunning(nil, true)
 		if err != nil {
@@ -87,12 +109,19 @@ func createCLI() *cli.App {
 			Usage:    "Stop all currently running VPN services",
 			Required: false,
 		},
+		&cli.BoolFlag{
+			Name:     "reconcile",
+			Usage:    "Correct recorded statuses of VPN services according to live system, e.g. periodically",
+			Required: false,
+		},
 		&cli.BoolFlag{
 			Name:     "status",
 			Usage:    "Show statuses of all registered VPN services",
 			Required: false,
 		},
 	}
+	app.Flags = append(app.Flags, store.CLIFlags()...)
+	app.Before = store.ConfigureFromContext
 	app.Action = perform
 	return app
 }
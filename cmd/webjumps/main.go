@@ -9,6 +9,7 @@ import (
 	"github.com/wiedzmin/toolbox/impl"
 	"github.com/wiedzmin/toolbox/impl/bookmarks"
 	"github.com/wiedzmin/toolbox/impl/shell"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"github.com/wiedzmin/toolbox/impl/vpn"
 	"github.com/wiedzmin/toolbox/impl/xserver"
@@ -20,7 +21,7 @@ var logger *zap.Logger
 
 func perform(ctx *cli.Context) error {
 	l := logger.Sugar()
-	webjumps, err := bookmarks.WebjumpsFromRedis("nav/webjumps")
+	webjumps, err := bookmarks.WebjumpsFromStore("nav/webjumps")
 	if err != nil {
 		return err
 	}
@@ -42,16 +43,17 @@ func perform(ctx *cli.Context) error {
 	}
 
 	xkb.EnsureEnglishKeyboardLayout()
-	key, err := ui.GetSelection(keys, "jump to", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
-	l.Debugw("[perform]", "key", key, "err", err)
+	selection, err := ui.GetSelection(ui.Items(keys), "jump to", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	l.Debugw("[perform]", "selection", selection, "err", err)
 	if err != nil {
 		return err
 	}
+	key := selection.Display
 	if webjump := webjumps.Get(key); webjump == nil {
 		l.Errorw("[main]", "failed to get webjump metadata for", key)
 	} else {
 		if webjump.VPN != "" {
-			services, err := vpn.ServicesFromRedis("net/vpn_meta")
+			services, err := vpn.ServicesFromStore("net/vpn_meta")
 			if err != nil {
 				return err
 			}
@@ -141,6 +143,9 @@ func createCLI() *cli.App {
 			Required: false,
 		},
 	}
+	app.Flags = append(app.Flags, store.CLIFlags()...)
+	app.Flags = append(app.Flags, ui.HistoryCLIFlags()...)
+	app.Before = ui.WithHistory(store.ConfigureReadOnlyFromContext)
 	app.Action = perform
 	return app
 }
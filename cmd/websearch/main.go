@@ -3,6 +3,7 @@ package main
 // FIXME: issue error when not predefined engine is selected (e.g. especially when trying to print search terms on this step)
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -10,7 +11,8 @@ import (
 	"github.com/urfave/cli/v2"
 	"github.com/wiedzmin/toolbox/impl"
 	"github.com/wiedzmin/toolbox/impl/bookmarks"
-	"github.com/wiedzmin/toolbox/impl/shell"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"github.com/wiedzmin/toolbox/impl/vpn"
 	"github.com/wiedzmin/toolbox/impl/xserver"
@@ -22,21 +24,22 @@ var logger *zap.Logger
 
 func perform(ctx *cli.Context) error {
 	l := logger.Sugar()
-	searchengines, err := bookmarks.WebjumpsFromRedis("nav/searchengines")
+	searchengines, err := bookmarks.WebjumpsFromStore("nav/searchengines")
 	if err != nil {
 		return err
 	}
 	xkb.EnsureEnglishKeyboardLayout()
-	key, err := ui.GetSelection(searchengines.Keys(), "search with", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
-	l.Debugw("[perform]", "key", key, "err", err)
+	selection, err := ui.GetSelection(ui.Items(searchengines.Keys()), "search with", ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+	l.Debugw("[perform]", "selection", selection, "err", err)
 	if err != nil {
 		return err
 	}
+	key := selection.Display
 	if searchengine := searchengines.Get(key); searchengine == nil {
 		l.Errorw("[perform]", "failed to get searchengine metadata for", key)
 	} else {
 		if searchengine.VPN != "" {
-			services, err := vpn.ServicesFromRedis("net/vpn_meta")
+			services, err := vpn.ServicesFromStore("net/vpn_meta")
 			if err != nil {
 				return err
 			}
@@ -58,11 +61,12 @@ func perform(ctx *cli.Context) error {
 			}
 			var searchTerm string
 			if ctx.Bool("prompt") {
-				searchTerm, err = ui.GetSelection([]string{}, fmt.Sprintf("%s | term", key), ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, true)
-				l.Debugw("[perform]", "searchTerm", searchTerm, "err", err)
+				termSelection, err := ui.GetSelection(nil, fmt.Sprintf("%s | term", key), ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, true)
+				l.Debugw("[perform]", "termSelection", termSelection, "err", err)
 				if err != nil {
 					return err
 				}
+				searchTerm = termSelection.Display
 			} else if ctx.String("term") != "" {
 				searchTerm = ctx.String("term")
 			} else {
@@ -79,8 +83,8 @@ func perform(ctx *cli.Context) error {
 				searchTermPrepared = strings.ReplaceAll(searchTermPrepared, ",", "")
 				searchTermPrepared = strings.ReplaceAll(searchTermPrepared, "'s", "")
 				l.Debugw("[perform]", "browserCmd", browserCmd, "searchengine.URL", searchengine.URL)
-				_, err := shell.ShellCmd(fmt.Sprintf("%s '%s%s'", browserCmd, searchengine.URL,
-					searchTermPrepared), nil, nil, nil, false, false)
+				argv := append(strings.Fields(browserCmd), searchengine.URL+searchTermPrepared)
+				err := proc.Run(context.Background(), argv, proc.Options{})
 				if err != nil {
 					return err
 				}
@@ -139,6 +143,9 @@ func createCLI() *cli.App {
 			Required: false,
 		},
 	}
+	app.Flags = append(app.Flags, store.CLIFlags()...)
+	app.Flags = append(app.Flags, ui.HistoryCLIFlags()...)
+	app.Before = ui.WithHistory(store.ConfigureReadOnlyFromContext)
 	app.Action = perform
 	return app
 }
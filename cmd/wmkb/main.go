@@ -6,26 +6,23 @@ import (
 
 	"github.com/urfave/cli/v2"
 	"github.com/wiedzmin/toolbox/impl"
-	"github.com/wiedzmin/toolbox/impl/redis"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"github.com/wiedzmin/toolbox/impl/xserver/wm"
 	"go.uber.org/zap"
 )
 
-var (
-	logger *zap.Logger
-	r      *redis.Client
-)
+var logger *zap.Logger
 
 func modes(ctx *cli.Context) error {
-	modebindings, err := wm.ModebindingsFromRedis("wm/modebindings")
+	modebindings, err := wm.ModebindingsFromStore("wm/modebindings")
 	if err != nil {
 		return err
 	}
 
 	prompt := "Modes bindings"
 	if ctx.Bool("fuzzy") {
-		_, err := ui.GetSelection(modebindings.Fuzzy(), prompt, ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+		_, err := ui.GetSelection(ui.Items(modebindings.Fuzzy()), prompt, ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
 		if err != nil {
 			return err
 		}
@@ -37,14 +34,14 @@ func modes(ctx *cli.Context) error {
 }
 
 func workspaces(ctx *cli.Context) error {
-	workspaces, err := wm.WorkspacesFromRedis("wm/workspaces")
+	workspaces, err := wm.WorkspacesFromStore("wm/workspaces")
 	if err != nil {
 		return err
 	}
 
 	prompt := "Workspaces"
 	if ctx.Bool("fuzzy") {
-		_, err := ui.GetSelection(workspaces.Fuzzy(), prompt, ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
+		_, err := ui.GetSelection(ui.Items(workspaces.Fuzzy()), prompt, ctx.String(ui.SelectorToolFlagName), ctx.String(impl.SelectorFontFlagName), true, false)
 		if err != nil {
 			return err
 		}
@@ -56,11 +53,11 @@ func workspaces(ctx *cli.Context) error {
 }
 
 func keys(ctx *cli.Context) error {
-	keybindings, err := wm.KeybindingsFromRedis("wm/keybindings")
+	keybindings, err := wm.KeybindingsFromStore("wm/keybindings")
 	if err != nil {
 		return err
 	}
-	modebindings, err := wm.ModebindingsFromRedis("wm/modebindings")
+	modebindings, err := wm.ModebindingsFromStore("wm/modebindings")
 	if err != nil {
 		return err
 	}
@@ -77,9 +74,9 @@ func keys(ctx *cli.Context) error {
 		if err != nil {
 			return err
 		}
-		parts, err := keybindings.GetPartsForSelection(selection)
-		if err != nil {
-			return err
+		parts, ok := selection.Value.(wm.KeybindingFormattedParts)
+		if !ok {
+			return fmt.Errorf("no keybinding found for '%s'", selection.Display)
 		}
 		formattedStr := fmt.Sprintf("command: %s\nkeys: %s\nmode: %s\nleave fullscreen: %s\nraw: %s\ndangling: %s\n",
 			parts.Cmd,
@@ -185,6 +182,8 @@ func createCLI() *cli.App {
 			Required: false,
 		},
 	}
+	app.Flags = append(app.Flags, store.CLIFlags()...)
+	app.Before = store.ConfigureReadOnlyFromContext
 	return app
 }
 
@@ -193,14 +192,8 @@ func main() {
 	defer logger.Sync()
 	l := logger.Sugar()
 
-	var err error
-
-	r, err = redis.NewRedisLocal()
-	if err != nil {
-		l.Errorw("[main]", "err", err)
-	}
 	app := createCLI()
-	err = app.Run(os.Args)
+	err := app.Run(os.Args)
 	if err != nil {
 		l.Errorw("[main]", "err", err)
 	}
@@ -6,7 +6,8 @@ import (
 	"strings"
 
 	jsoniter "github.com/json-iterator/go"
-	"github.com/wiedzmin/toolbox/impl/redis"
+	"github.com/wiedzmin/toolbox/impl"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"go.uber.org/zap"
 )
 
@@ -48,18 +49,10 @@ type Bookmarks struct {
 
 type FnFormatBookmarkKey func(string, Bookmark) string
 
-var (
-	logger *zap.Logger
-	r      *redis.Client
-)
+var logger *zap.Logger
 
 func init() {
-	var err error
-	r, err = redis.NewRedisLocal()
-	if err != nil {
-		l := logger.Sugar()
-		l.Fatalw("[init]", "failed connecting to Redis", err)
-	}
+	logger = impl.NewLogger()
 }
 
 func NewWebjumps(data []byte) (*Webjumps, error) {
@@ -72,7 +65,11 @@ func NewWebjumps(data []byte) (*Webjumps, error) {
 	return &result, nil
 }
 
-func WebjumpsFromRedis(key string) (*Webjumps, error) {
+func WebjumpsFromStore(key string) (*Webjumps, error) {
+	r, err := store.Shared()
+	if err != nil {
+		return nil, err
+	}
 	webjumpsData, err := r.GetValue(key)
 	if err != nil {
 		return nil, err
@@ -139,7 +136,11 @@ func NewSearchEngines(data []byte) (*SearchEngines, error) {
 	return &result, nil
 }
 
-func SearchEnginesFromRedis(key string) (*SearchEngines, error) {
+func SearchEnginesFromStore(key string) (*SearchEngines, error) {
+	r, err := store.Shared()
+	if err != nil {
+		return nil, err
+	}
 	searchenginesData, err := r.GetValue(key)
 	if err != nil {
 		return nil, err
@@ -173,7 +174,11 @@ func NewBookmarks(data []byte) (*Bookmarks, error) {
 	return &result, nil
 }
 
-func BookmarksFromRedis(key string) (*Bookmarks, error) {
+func BookmarksFromStore(key string) (*Bookmarks, error) {
+	r, err := store.Shared()
+	if err != nil {
+		return nil, err
+	}
 	bookmarksData, err := r.GetValue(key)
 	if err != nil {
 		return nil, err
@@ -14,10 +14,25 @@ var (
 func SelectSession(path, prompt, tool, font string, regexpsWhitelist, regexpsBlacklist []string) (*string, error) {
 	files := fs.NewFSCollection(path, regexpsWhitelist, regexpsBlacklist, false).Emit(false)
 	xkb.EnsureEnglishKeyboardLayout()
-	sessionName, err := ui.GetSelection(files, prompt, tool, font, true, false)
+	selection, err := ui.GetSelection(ui.Items(files), prompt, tool, font, true, false)
 
 	if err != nil {
 		return nil, err
 	}
-	return &sessionName, nil
+	return &selection.Display, nil
+}
+
+// SelectSessions collects session files and allows selecting several ones
+func SelectSessions(path, prompt, tool, font string, regexpsWhitelist, regexpsBlacklist []string) ([]string, error) {
+	files := fs.NewFSCollection(path, regexpsWhitelist, regexpsBlacklist, false).Emit(false)
+	xkb.EnsureEnglishKeyboardLayout()
+	selection, err := ui.GetMultiSelection(ui.Items(files), prompt, tool, font, true, false)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, item := range selection {
+		result = append(result, item.Display)
+	}
+	return result, nil
 }
@@ -12,7 +12,7 @@ import (
 	"github.com/wiedzmin/toolbox/impl/fs"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 type SessionFormat int8
@@ -198,11 +198,14 @@ func ExportSession(path string, data *SessionLayout, format SessionFormat) error
 	defer writer.Flush()
 	switch format {
 	case SESSION_FORMAT_YAML:
-		b, err := yaml.Marshal(data)
+		// NOTE: keeping indentation qutebrowser itself uses, yaml.v3 defaults to 4 spaces
+		encoder := yaml.NewEncoder(writer)
+		encoder.SetIndent(2)
+		err := encoder.Encode(data)
 		if err != nil {
 			return err
 		}
-		_, err = writer.Write(b)
+		err = encoder.Close()
 		if err != nil {
 			return err
 		}
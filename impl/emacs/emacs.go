@@ -1,17 +1,26 @@
 package emacs
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/wiedzmin/toolbox/impl"
 	"github.com/wiedzmin/toolbox/impl/fs"
-	"github.com/wiedzmin/toolbox/impl/shell"
+	"github.com/wiedzmin/toolbox/impl/notify"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
 	"github.com/wiedzmin/toolbox/impl/systemd"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"go.uber.org/zap"
 )
 
+const (
+	// NOTE: Emacs takes a while to start with heavy configurations
+	restartTimeout    = 2 * time.Minute
+	stillWaitingAfter = 5 * time.Second
+)
+
 var logger *zap.Logger
 
 func init() {
@@ -22,6 +31,7 @@ func SocketPath() string {
 	return fs.AtRunUser("emacs/server")
 }
 
+// ServiceState ensures Emacs service is running, optionally restarting it, exits otherwise
 func ServiceState(tag string, restart bool) {
 	l := logger.Sugar()
 	service := systemd.Unit{Name: "emacs.service", User: true}
@@ -30,39 +40,42 @@ func ServiceState(tag string, restart bool) {
 	if err != nil {
 		l.Errorw("[emacs.ServiceState]", "err", err)
 	}
-	if !isActive {
-		l.Errorw("[emacs.ServiceState]", "state", "not running")
-		if restart {
-			l.Errorw("[emacs.ServiceState]", "NOTE", "restarting is not properly implemented yet")
-			// l.Errorw("[emacs.ServiceState]", "state", "restarting")
-			// ui.NotifyCritical(tag, "Emacs service not running, trying to restart...")
-			// err = service.Restart() // FIXME: elaborate repeating logic and state synchronization, consider merging logic with implementation from `vpn` module
-			// time.Sleep(3 * time.Second)
-			// if err != nil {
-			// 	l.Errorw("[emacs.ServiceState]", "err", err)
-			// 	ui.NotifyCritical(tag, "Emacs service failed to start")
-			// 	os.Exit(1)
-			// }
-			ui.NotifyCritical(tag, "Emacs service not running")
-			os.Exit(1)
-		} else {
-			ui.NotifyCritical(tag, "Emacs service not running")
-			os.Exit(1)
-		}
+	if isActive {
+		return
+	}
+	l.Errorw("[emacs.ServiceState]", "state", "not running")
+	if !restart {
+		ui.NotifyCritical(tag, "Emacs service not running")
+		os.Exit(1)
+	}
+	notificationTag := "emacs/" + service.Name
+	ui.NotifyTagged(notificationTag, tag, "Emacs service not running, trying to restart...", notify.UrgencyCritical)
+	err = service.RestartAndWait(systemd.WaitOptions{
+		Timeout:   restartTimeout,
+		SlowAfter: stillWaitingAfter,
+		OnSlow: func(elapsed time.Duration) {
+			ui.NotifyTagged(notificationTag, tag, fmt.Sprintf("Emacs service is still starting (%s)...",
+				elapsed.Round(time.Second)), notify.UrgencyNormal)
+		},
+	})
+	if err != nil {
+		l.Errorw("[emacs.ServiceState]", "err", err)
+		ui.NotifyTagged(notificationTag, tag, fmt.Sprintf("Emacs service failed to start: %s", err.Error()), notify.UrgencyCritical)
+		os.Exit(1)
 	}
+	ui.NotifyTagged(notificationTag, tag, "Emacs service restarted", notify.UrgencyNormal)
 }
 
 func SendToServer(elisp string, createFrame bool) error {
 	l := logger.Sugar()
 	l.Debugw("[SendToServer]", "elisp", elisp)
 
-	var createFrameStr string
+	argv := []string{"emacsclient"}
 	if createFrame {
-		createFrameStr = "-c "
-	} else {
-		createFrameStr = ""
+		argv = append(argv, "-c")
 	}
-	_, err := shell.ShellCmd(fmt.Sprintf("emacsclient %s-s %s -e '%s'", createFrameStr, SocketPath(), elisp), nil, nil, nil, false, false)
+	argv = append(argv, "-s", SocketPath(), "-e", elisp)
+	err := proc.Run(context.Background(), argv, proc.Options{})
 	if err != nil {
 		return err
 	}
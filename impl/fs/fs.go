@@ -240,6 +240,16 @@ func FileExists(path string) bool {
 	return true
 }
 
+func DirExists(path string) bool {
+	l := logger.Sugar()
+	fi, err := os.Stat(path)
+	if err != nil {
+		l.Debugw("[DirExists]", "desc", "error occurred, assuming directory not exist", "err", err)
+		return false
+	}
+	return fi.IsDir()
+}
+
 func AtHomedir(suffix string) string {
 	return fmt.Sprintf("%s/%s", os.Getenv("HOME"), strings.TrimPrefix(suffix, "/"))
 }
@@ -251,3 +261,7 @@ func AtRunUser(suffix string) string {
 func AtDotConfig(suffix string) string {
 	return fmt.Sprintf("%s/.config/%s", os.Getenv("HOME"), strings.TrimPrefix(suffix, "/"))
 }
+
+func AtDotCache(suffix string) string {
+	return fmt.Sprintf("%s/.cache/%s", os.Getenv("HOME"), strings.TrimPrefix(suffix, "/"))
+}
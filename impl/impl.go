@@ -73,7 +73,7 @@ func (e ErrNotImplemented) Error() string {
 
 func GetEnvTraits() EnvTraits {
 	_, displaySet := os.LookupEnv("DISPLAY")
-	isTTY := isatty.IsCygwinTerminal(os.Stdout.Fd())
+	isTTY := isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
 	return EnvTraits{
 		InX:     displaySet,
 		InShell: isTTY,
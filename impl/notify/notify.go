@@ -0,0 +1,210 @@
+package notify
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/wiedzmin/toolbox/impl"
+	"go.uber.org/zap"
+)
+
+const (
+	dbusDestination              = "org.freedesktop.Notifications"
+	dbusPath                     = "/org/freedesktop/Notifications"
+	dbusInterface                = "org.freedesktop.Notifications"
+	dbusMethodNotify             = dbusInterface + ".Notify"
+	dbusMethodClose              = dbusInterface + ".CloseNotification"
+	dbusSignalActionInvoked      = dbusInterface + ".ActionInvoked"
+	dbusSignalNotificationClosed = dbusInterface + ".NotificationClosed"
+
+	hintUrgency = "urgency"
+
+	AppNameDefault = "toolbox"
+
+	// TimeoutDefault leaves expiration up to notification server
+	TimeoutDefault time.Duration = 0
+	// TimeoutNever makes notification stay until dismissed by user
+	TimeoutNever time.Duration = -1
+)
+
+type Urgency byte
+
+const (
+	UrgencyLow Urgency = iota
+	UrgencyNormal
+	UrgencyCritical
+)
+
+var (
+	logger *zap.Logger
+
+	sharedClient *Client
+	sharedErr    error
+	sharedOnce   sync.Once
+)
+
+func init() {
+	logger = impl.NewLogger()
+}
+
+type ErrNotificationsUnavailable struct {
+	Cause error
+}
+
+func (e ErrNotificationsUnavailable) Error() string {
+	return fmt.Sprintf("notifications server is unavailable: %v", e.Cause)
+}
+
+func (e ErrNotificationsUnavailable) Unwrap() error {
+	return e.Cause
+}
+
+// Action is a notification button, Callback is run when user clicks it
+type Action struct {
+	Key      string
+	Label    string
+	Callback func() error
+}
+
+// Notification describes desktop notification as per Desktop Notifications Specification
+// ReplacesID, if not zero, makes notification server update previously shown notification instead of showing new one
+type Notification struct {
+	AppName    string
+	Title      string
+	Body       string
+	Icon       string
+	Urgency    Urgency
+	Timeout    time.Duration
+	ReplacesID uint32
+	Actions    []Action
+}
+
+func (n Notification) actionsList() []string {
+	var result []string
+	for _, a := range n.Actions {
+		result = append(result, a.Key, a.Label)
+	}
+	return result
+}
+
+func (n Notification) timeoutMs() int32 {
+	if n.Timeout < 0 {
+		return 0
+	}
+	if n.Timeout == TimeoutDefault {
+		return -1
+	}
+	return int32(n.Timeout / time.Millisecond)
+}
+
+// Client talks to notifications server over session D-Bus
+type Client struct {
+	conn  *dbus.Conn
+	obj   dbus.BusObject
+	mutex sync.Mutex
+}
+
+// NewClient connects to session bus
+func NewClient() (*Client, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, ErrNotificationsUnavailable{Cause: err}
+	}
+	return &Client{conn: conn, obj: conn.Object(dbusDestination, dbusPath)}, nil
+}
+
+// Shared returns client, shared between all packages, connecting on first use
+func Shared() (*Client, error) {
+	sharedOnce.Do(func() {
+		sharedClient, sharedErr = NewClient()
+	})
+	return sharedClient, sharedErr
+}
+
+// Send shows notification, returning its id, which could be used for replacing or closing it later
+func (c *Client) Send(n Notification) (uint32, error) {
+	l := logger.Sugar()
+	appName := n.AppName
+	if appName == "" {
+		appName = AppNameDefault
+	}
+	hints := map[string]dbus.Variant{
+		hintUrgency: dbus.MakeVariant(byte(n.Urgency)),
+	}
+	var id uint32
+	err := c.obj.Call(dbusMethodNotify, 0, appName, n.ReplacesID, n.Icon, n.Title, n.Body,
+		n.actionsList(), hints, n.timeoutMs()).Store(&id)
+	l.Debugw("[Client.Send]", "title", n.Title, "replaces", n.ReplacesID, "id", id, "err", err)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Close closes notification with provided id
+func (c *Client) Close(id uint32) error {
+	return c.obj.Call(dbusMethodClose, 0, id).Err
+}
+
+// SendAndWait shows notification and waits until user either clicks one of its actions or dismisses it,
+// or until timeout (zero means waiting indefinitely) expires
+// Callback of clicked action is run, the key of that action is returned, empty key means no action has been taken
+func (c *Client) SendAndWait(n Notification, timeout time.Duration) (string, error) {
+	l := logger.Sugar()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	matchOpts := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(dbusPath),
+		dbus.WithMatchInterface(dbusInterface),
+	}
+	err := c.conn.AddMatchSignal(matchOpts...)
+	if err != nil {
+		return "", err
+	}
+	defer c.conn.RemoveMatchSignal(matchOpts...)
+	signals := make(chan *dbus.Signal, 10)
+	c.conn.Signal(signals)
+	defer c.conn.RemoveSignal(signals)
+
+	// NOTE: subscribing goes first, otherwise fast enough clicks could be missed
+	id, err := c.Send(n)
+	if err != nil {
+		return "", err
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+	for {
+		select {
+		case signal := <-signals:
+			if len(signal.Body) < 2 {
+				continue
+			}
+			if signalID, ok := signal.Body[0].(uint32); !ok || signalID != id {
+				continue
+			}
+			switch signal.Name {
+			case dbusSignalActionInvoked:
+				key, _ := signal.Body[1].(string)
+				l.Debugw("[Client.SendAndWait]", "id", id, "action", key)
+				for _, a := range n.Actions {
+					if a.Key == key && a.Callback != nil {
+						return key, a.Callback()
+					}
+				}
+				return key, nil
+			case dbusSignalNotificationClosed:
+				l.Debugw("[Client.SendAndWait]", "id", id, "closed", signal.Body[1])
+				return "", nil
+			}
+		case <-expired:
+			l.Debugw("[Client.SendAndWait]", "id", id, "summary", "timed out")
+			return "", c.Close(id)
+		}
+	}
+}
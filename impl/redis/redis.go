@@ -1,34 +1,262 @@
 package redis
 
 import (
+	"fmt"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/mediocregopher/radix/v3"
+	"github.com/urfave/cli/v2"
 	"github.com/wiedzmin/toolbox/impl"
 	"go.uber.org/zap"
 )
 
-var logger *zap.Logger
+const (
+	NetworkTCP  = "tcp"
+	NetworkUnix = "unix"
+
+	AddressDefault  = "127.0.0.1:6379"
+	PoolSizeDefault = 1
+	TimeoutDefault  = 5 * time.Second
+
+	AddressFlagName  = "redis-address"
+	PasswordFlagName = "redis-password"
+	DBFlagName       = "redis-db"
+	PoolSizeFlagName = "redis-pool-size"
+	TimeoutFlagName  = "redis-timeout"
+)
+
+var (
+	logger *zap.Logger
+
+	AddressEnvVarName  = fmt.Sprintf("%s_REDIS_ADDRESS", impl.EnvPrefix)
+	PasswordEnvVarName = fmt.Sprintf("%s_REDIS_PASSWORD", impl.EnvPrefix)
+	DBEnvVarName       = fmt.Sprintf("%s_REDIS_DB", impl.EnvPrefix)
+	PoolSizeEnvVarName = fmt.Sprintf("%s_REDIS_POOL_SIZE", impl.EnvPrefix)
+	TimeoutEnvVarName  = fmt.Sprintf("%s_REDIS_TIMEOUT", impl.EnvPrefix)
+
+	sharedOptions Options
+	sharedClient  *Client
+	sharedMutex   sync.Mutex
+)
 
 func init() {
 	logger = impl.NewLogger()
+	sharedOptions = OptionsFromEnv()
+}
+
+// Options describes how to reach Redis server
+// Address is either "host:port" (tcp) or socket path, optionally prefixed with "unix://"
+type Options struct {
+	Network  string
+	Address  string
+	Password string
+	DB       int
+	PoolSize int
+	Timeout  time.Duration
 }
 
 type Client struct {
 	conn *radix.Pool
 }
 
-func NewRedisLocal() (*Client, error) {
+// DefaultOptions returns options for local Redis instance listening on default TCP port
+func DefaultOptions() Options {
+	return Options{
+		Network:  NetworkTCP,
+		Address:  AddressDefault,
+		PoolSize: PoolSizeDefault,
+		Timeout:  TimeoutDefault,
+	}
+}
+
+// OptionsFromEnv returns default options, overridden with TB_REDIS_* environment variables, if any
+func OptionsFromEnv() Options {
 	l := logger.Sugar()
-	pool, err := radix.NewPool("tcp", "127.0.0.1:6379", 1)
+	result := DefaultOptions()
+	if address, ok := os.LookupEnv(AddressEnvVarName); ok && address != "" {
+		result.SetAddress(address)
+	}
+	if password, ok := os.LookupEnv(PasswordEnvVarName); ok {
+		result.Password = password
+	}
+	if db, ok := os.LookupEnv(DBEnvVarName); ok {
+		value, err := strconv.Atoi(db)
+		if err != nil {
+			l.Warnw("[OptionsFromEnv]", "var", DBEnvVarName, "err", err)
+		} else {
+			result.DB = value
+		}
+	}
+	if poolSize, ok := os.LookupEnv(PoolSizeEnvVarName); ok {
+		value, err := strconv.Atoi(poolSize)
+		if err != nil {
+			l.Warnw("[OptionsFromEnv]", "var", PoolSizeEnvVarName, "err", err)
+		} else {
+			result.PoolSize = value
+		}
+	}
+	if timeout, ok := os.LookupEnv(TimeoutEnvVarName); ok {
+		value, err := time.ParseDuration(timeout)
+		if err != nil {
+			l.Warnw("[OptionsFromEnv]", "var", TimeoutEnvVarName, "err", err)
+		} else {
+			result.Timeout = value
+		}
+	}
+	return result
+}
+
+// OptionsFromContext returns options from environment, overridden with explicitly set CLI flags
+func OptionsFromContext(ctx *cli.Context) Options {
+	result := OptionsFromEnv()
+	if ctx.IsSet(AddressFlagName) {
+		result.SetAddress(ctx.String(AddressFlagName))
+	}
+	if ctx.IsSet(PasswordFlagName) {
+		result.Password = ctx.String(PasswordFlagName)
+	}
+	if ctx.IsSet(DBFlagName) {
+		result.DB = ctx.Int(DBFlagName)
+	}
+	if ctx.IsSet(PoolSizeFlagName) {
+		result.PoolSize = ctx.Int(PoolSizeFlagName)
+	}
+	if ctx.IsSet(TimeoutFlagName) {
+		result.Timeout = ctx.Duration(TimeoutFlagName)
+	}
+	return result
+}
+
+// SetAddress sets address along with network type, guessed from address form
+func (o *Options) SetAddress(address string) {
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		o.Network = NetworkUnix
+		o.Address = strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "/"):
+		o.Network = NetworkUnix
+		o.Address = address
+	default:
+		o.Network = NetworkTCP
+		o.Address = strings.TrimPrefix(address, "tcp://")
+	}
+}
+
+func (o Options) dialOpts() []radix.DialOpt {
+	var result []radix.DialOpt
+	if o.Timeout > 0 {
+		result = append(result, radix.DialTimeout(o.Timeout))
+	}
+	if o.Password != "" {
+		result = append(result, radix.DialAuthPass(o.Password))
+	}
+	if o.DB != 0 {
+		result = append(result, radix.DialSelectDB(o.DB))
+	}
+	return result
+}
+
+// CLIFlags returns flags for tuning Redis connection, to be appended to command's own ones
+func CLIFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     AddressFlagName,
+			EnvVars:  []string{AddressEnvVarName},
+			Usage:    "Redis address, either host:port or unix socket path",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     PasswordFlagName,
+			EnvVars:  []string{PasswordEnvVarName},
+			Usage:    "Redis password",
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     DBFlagName,
+			EnvVars:  []string{DBEnvVarName},
+			Usage:    "Redis database index",
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     PoolSizeFlagName,
+			EnvVars:  []string{PoolSizeEnvVarName},
+			Usage:    "Redis connection pool size",
+			Required: false,
+		},
+		&cli.DurationFlag{
+			Name:     TimeoutFlagName,
+			EnvVars:  []string{TimeoutEnvVarName},
+			Usage:    "Redis connect/read/write timeout",
+			Required: false,
+		},
+	}
+}
+
+// NewClient connects to Redis server according to provided options
+func NewClient(opts Options) (*Client, error) {
+	l := logger.Sugar()
+	poolSize := opts.PoolSize
+	if poolSize <= 0 {
+		poolSize = PoolSizeDefault
+	}
+	dialOpts := opts.dialOpts()
+	connFunc := func(network, addr string) (radix.Conn, error) {
+		return radix.Dial(network, addr, dialOpts...)
+	}
+	pool, err := radix.NewPool(opts.Network, opts.Address, poolSize, radix.PoolConnFunc(connFunc))
 	if err != nil {
-		l.Warnw("[NewRedisLocal]", "err", err)
+		l.Warnw("[NewClient]", "network", opts.Network, "address", opts.Address, "db", opts.DB, "err", err)
 		return nil, err
 	}
-	l.Debugw("[NewRedisLocal]", "pool", pool)
+	l.Debugw("[NewClient]", "network", opts.Network, "address", opts.Address, "db", opts.DB, "poolSize", poolSize)
 	return &Client{pool}, nil
 }
 
+// NewRedisLocal connects to local Redis server with default options
+func NewRedisLocal() (*Client, error) {
+	return NewClient(DefaultOptions())
+}
+
+// Configure sets options for shared client, dropping already established connection, if any
+func Configure(opts Options) {
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+	if sharedClient != nil {
+		sharedClient.Close()
+		sharedClient = nil
+	}
+	sharedOptions = opts
+}
+
+// ConfigureFromContext configures shared client from CLI flags, suitable for usage as `cli.App.Before`
+func ConfigureFromContext(ctx *cli.Context) error {
+	Configure(OptionsFromContext(ctx))
+	return nil
+}
+
+// Shared returns client, shared between all packages, connecting on first use
+func Shared() (*Client, error) {
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+	if sharedClient != nil {
+		return sharedClient, nil
+	}
+	client, err := NewClient(sharedOptions)
+	if err != nil {
+		return nil, err
+	}
+	sharedClient = client
+	return sharedClient, nil
+}
+
+func (r *Client) Close() error {
+	return r.conn.Close()
+}
+
 func (r *Client) GetValue(key string) ([]byte, error) {
 	l := logger.Sugar()
 	var result []byte
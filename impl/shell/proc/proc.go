@@ -0,0 +1,190 @@
+package proc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/wiedzmin/toolbox/impl"
+	"go.uber.org/zap"
+)
+
+const safeWordChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-"
+
+var logger *zap.Logger
+
+func init() {
+	logger = impl.NewLogger()
+}
+
+// Options tunes command execution, zero value means inheriting environment and CWD, with no stdin and no timeout
+// Env entries are appended to current process environment
+type Options struct {
+	Stdin         *string
+	Env           []string
+	Dir           string
+	Timeout       time.Duration
+	CombineOutput bool
+}
+
+type ErrInvalidArgv struct {
+	Argv []string
+}
+
+func (e ErrInvalidArgv) Error() string {
+	return fmt.Sprintf("invalid command: %q", e.Argv)
+}
+
+type ErrTimeout struct {
+	Argv    []string
+	Timeout time.Duration
+}
+
+func (e ErrTimeout) Error() string {
+	return fmt.Sprintf("command %q timed out after %s", e.Argv, e.Timeout)
+}
+
+// command prepares process to run, arguments are passed as is, with no shell being involved,
+// so there is no need to quote or escape them
+func command(ctx context.Context, argv []string, opts Options) (*exec.Cmd, context.Context, context.CancelFunc, error) {
+	if len(argv) == 0 || argv[0] == "" {
+		return nil, nil, nil, ErrInvalidArgv{Argv: argv}
+	}
+	cancel := func() {}
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	c := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	c.Env = append(os.Environ(), opts.Env...)
+	c.Dir = opts.Dir
+	if opts.Stdin != nil {
+		c.Stdin = strings.NewReader(*opts.Stdin)
+	}
+	return c, ctx, cancel, nil
+}
+
+// wrapErr distinguishes own timeout from other failures, including cancellation of parent context
+func wrapErr(ctx context.Context, err error, argv []string, opts Options) error {
+	if err != nil && opts.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrTimeout{Argv: argv, Timeout: opts.Timeout}
+	}
+	return err
+}
+
+// Output runs command and returns its output, with trailing newlines trimmed
+func Output(ctx context.Context, argv []string, opts Options) (string, error) {
+	l := logger.Sugar()
+	c, ctx, cancel, err := command(ctx, argv, opts)
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+	l.Debugw("[Output]", "argv", argv, "env", opts.Env, "dir", opts.Dir, "timeout", opts.Timeout)
+	var out []byte
+	if opts.CombineOutput {
+		out, err = c.CombinedOutput()
+	} else {
+		out, err = c.Output()
+	}
+	result := strings.TrimRight(string(out), "\n")
+	l.Debugw("[Output]", "argv", argv, "result", result, "err", err)
+	return result, wrapErr(ctx, err, argv, opts)
+}
+
+// Run runs command and waits for it to finish, discarding its output
+func Run(ctx context.Context, argv []string, opts Options) error {
+	l := logger.Sugar()
+	c, ctx, cancel, err := command(ctx, argv, opts)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	l.Debugw("[Run]", "argv", argv, "env", opts.Env, "dir", opts.Dir, "timeout", opts.Timeout)
+	err = c.Run()
+	l.Debugw("[Run]", "argv", argv, "err", err)
+	return wrapErr(ctx, err, argv, opts)
+}
+
+type ErrUnterminated struct {
+	Command string
+	What    string
+}
+
+func (e ErrUnterminated) Error() string {
+	return fmt.Sprintf("unterminated %s in command: '%s'", e.What, e.Command)
+}
+
+// SplitWords splits command line into argv the way POSIX shell does, honoring single and double quotes
+// and backslash escapes, yet with no expansions of any kind
+func SplitWords(command string) ([]string, error) {
+	var result []string
+	var word strings.Builder
+	inWord := false
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\':
+			if i+1 >= len(runes) {
+				return nil, ErrUnterminated{Command: command, What: "escape"}
+			}
+			i++
+			// NOTE: escaped newline is a line continuation
+			if runes[i] != '\n' {
+				word.WriteRune(runes[i])
+			}
+			inWord = true
+		case r == '\'':
+			end := strings.IndexRune(string(runes[i+1:]), '\'')
+			if end < 0 {
+				return nil, ErrUnterminated{Command: command, What: "single quote"}
+			}
+			quoted := []rune(string(runes[i+1:])[:end])
+			word.WriteString(string(quoted))
+			i += len(quoted) + 1
+			inWord = true
+		case r == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				// NOTE: inside double quotes backslash only escapes those characters which are special there
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, ErrUnterminated{Command: command, What: "double quote"}
+			}
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				result = append(result, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		result = append(result, word.String())
+	}
+	return result, nil
+}
+
+// QuoteWord quotes string for safe inclusion into shell command line, as a single word
+// Strings consisting of safe characters only are left as is
+func QuoteWord(s string) string {
+	if s != "" && strings.Trim(s, safeWordChars) == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
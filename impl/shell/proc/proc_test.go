@@ -0,0 +1,110 @@
+package proc
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"ls -la", []string{"ls", "-la"}},
+		{"  ls \t -la\n", []string{"ls", "-la"}},
+		{`echo 'a b' "c d"`, []string{"echo", "a b", "c d"}},
+		{`echo 'it'\''s'`, []string{"echo", "it's"}},
+		{`echo "a \"b\" \$c \d"`, []string{"echo", `a "b" $c \d`}},
+		{`echo a\ b`, []string{"echo", "a b"}},
+		{"echo a\\\nb", []string{"echo", "ab"}},
+		{`echo '' ""`, []string{"echo", "", ""}},
+		{`echo pre'mid'"post"`, []string{"echo", "premidpost"}},
+		{`echo '$HOME' "*"`, []string{"echo", "$HOME", "*"}},
+		{`echo 'привет мир'`, []string{"echo", "привет мир"}},
+	}
+	for _, tt := range tests {
+		got, err := SplitWords(tt.command)
+		if err != nil {
+			t.Errorf("SplitWords(%q): unexpected error: %v", tt.command, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("SplitWords(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestSplitWordsUnterminated(t *testing.T) {
+	tests := []struct {
+		command string
+		what    string
+	}{
+		{`echo 'a`, "single quote"},
+		{`echo "a`, "double quote"},
+		{`echo "a\"`, "double quote"},
+		{`echo a\`, "escape"},
+	}
+	for _, tt := range tests {
+		_, err := SplitWords(tt.command)
+		var unterminated ErrUnterminated
+		if !errors.As(err, &unterminated) {
+			t.Errorf("SplitWords(%q): got error %v, want ErrUnterminated", tt.command, err)
+			continue
+		}
+		if unterminated.What != tt.what {
+			t.Errorf("SplitWords(%q): got unterminated %s, want %s", tt.command, unterminated.What, tt.what)
+		}
+	}
+}
+
+func TestQuoteWord(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"ls", "ls"},
+		{"/usr/bin/env", "/usr/bin/env"},
+		{"", "''"},
+		{"a b", "'a b'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+	}
+	for _, tt := range tests {
+		if got := QuoteWord(tt.word); got != tt.want {
+			t.Errorf("QuoteWord(%q) = %s, want %s", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteWordRoundTrip(t *testing.T) {
+	words := []string{
+		"plain",
+		"",
+		"with space",
+		"it's",
+		`double "quoted"`,
+		`back\slash`,
+		"$HOME `cmd` $(cmd)",
+		"glob * ? [a]",
+		"multi\nline",
+		"tab\there",
+		"'''",
+		"юникод",
+	}
+	var quoted []string
+	for _, w := range words {
+		quoted = append(quoted, QuoteWord(w))
+	}
+	command := strings.Join(quoted, " ")
+	got, err := SplitWords(command)
+	if err != nil {
+		t.Fatalf("SplitWords(%q): unexpected error: %v", command, err)
+	}
+	if !slices.Equal(got, words) {
+		t.Errorf("SplitWords(%q) = %q, want %q", command, got, words)
+	}
+}
@@ -5,13 +5,15 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"syscall"
 
 	"github.com/urfave/cli/v2"
 	"github.com/wiedzmin/toolbox/impl"
-	"github.com/wiedzmin/toolbox/impl/shell/tmux"
+	"github.com/wiedzmin/toolbox/impl/fs"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
 	"go.uber.org/zap"
 )
 
@@ -19,6 +21,7 @@ const (
 	TerminalCommandFlagName = "term-command"
 	TerminalBackendFlagName = "term-backend"
 	TerminalBackendDefault  = "kitty"
+	TerminalHoldFlagName    = "term-hold"
 
 	grepMaxFileSize = 65536
 	osMetadataPath  = "/etc/os-release"
@@ -30,8 +33,10 @@ var (
 	KittySocketEnvVarName = fmt.Sprintf("%s_KITTY_SOCKET", impl.EnvPrefix)
 )
 
+// TerminalTraits selects terminal backend, Hold keeps terminal open after command exits
 type TerminalTraits struct {
 	Backend, VTermCmd, TmuxSession string
+	Hold                           bool
 }
 
 type ErrInvalidCmd struct {
@@ -59,6 +64,7 @@ func TermTraitsFromContext(ctx *cli.Context) TerminalTraits {
 		Backend:     ctx.String(TerminalBackendFlagName),
 		VTermCmd:    ctx.String(TerminalCommandFlagName),
 		TmuxSession: ctx.String("tmux-session"),
+		Hold:        ctx.Bool(TerminalHoldFlagName),
 	}
 }
 
@@ -94,102 +100,6 @@ func ShellCmd(cmd string, input *string, cwd *string, env []string, needOutput,
 	}
 }
 
-// FIXME: remove duplication below
-func OpenTerminal(path string, traits TerminalTraits) error {
-	l := logger.Sugar()
-	if len(traits.VTermCmd) == 0 && traits.Backend != "kitty" {
-		return ErrInvalidCmd{Cmd: traits.VTermCmd}
-	}
-	if impl.HasSpaces(path) {
-		path = impl.Quote(path)
-	}
-	switch traits.Backend {
-	case "kitty":
-		l.Debugw("[OpenTerminal]", "backend", "kitty")
-		return OpenKitty(path)
-	// TODO: implement opening tmux pane (or Zellij, or something alike)
-	default:
-		// NOTE: because VT programs has no agreement on syntax for just opening new
-		// window/pane with particular CWD, we could not relay on any defaults for this
-		// So it would be more correct to implement this functionality for each VT tool
-		// being put into use over time (such as for Kitty over here).
-		l.Debugw("[OpenTerminal]", "error", "unsupported terminal")
-		return ErrInvalidCmd{Cmd: traits.VTermCmd}
-	}
-}
-
-func RunInTerminal(cmd, title string, traits TerminalTraits) error {
-	l := logger.Sugar()
-	if len(traits.VTermCmd) == 0 && traits.Backend != "kitty" {
-		return ErrInvalidCmd{Cmd: traits.VTermCmd}
-	}
-	switch traits.Backend {
-	case "kitty":
-		return RunInKitty(cmd, title)
-	case "tmux":
-		return RunInTmux(cmd, traits.TmuxSession, title, traits.VTermCmd)
-	default:
-		l.Debugw("[OpenInTerminal]", "backend", traits.Backend, "summary", "unknown terminal backend")
-		return RunInBareTerminal(cmd, traits.VTermCmd)
-	}
-}
-
-func OpenKitty(path string) error {
-	l := logger.Sugar()
-	impl.EnsureBinary("kitty", *logger)
-	l.Debugw("[OpenKitty]", "path", path)
-	socket := os.Getenv(KittySocketEnvVarName)
-	if socket == "" {
-		return ErrNoEnvVar{Name: KittySocketEnvVarName}
-	}
-	_, err := ShellCmd(fmt.Sprintf("kitty @ --to %s launch --cwd %s --type os-window", socket, path), nil, nil, nil, false, false)
-	if err != nil {
-		// NOTE: most likely, kitty is not running, hence no socket listening - let's start new instance with required CWD
-		_, err = ShellCmd(fmt.Sprintf("kitty --working-directory %s", path), nil, nil, nil, false, false)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func RunInKitty(cmd, title string) error {
-	impl.EnsureBinary("kitty", *logger)
-	socket := os.Getenv(KittySocketEnvVarName)
-	if socket == "" {
-		return ErrNoEnvVar{Name: KittySocketEnvVarName}
-	}
-	_, err := ShellCmd(fmt.Sprintf("kitty @ --to %s launch --type os-window sh -c \"%s\"", socket, cmd), nil, nil, nil, false, false)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func RunInTmux(cmd, title, session, vtermCmd string) error {
-	if len(session) > 0 {
-		impl.EnsureBinary("tmux", *logger)
-		session, err := tmux.GetSession(session, false, true)
-		switch err.(type) {
-		case tmux.ErrSessionNotFound:
-			return RunInBareTerminal(cmd, vtermCmd)
-		default:
-			if err != nil {
-				return err
-			}
-			return session.NewWindow(cmd, title, "", true)
-		}
-	} else {
-		return RunInBareTerminal(cmd, vtermCmd)
-	}
-}
-
-func RunInBareTerminal(cmd, vtermCmd string) error {
-	// TODO: elaborate/ensure `transient` commands proper handling, i.e. those who need "; read" thereafter
-	_, err := ShellCmd(fmt.Sprintf("%s \"sh -c %s\"", vtermCmd, cmd), nil, nil, nil, false, false)
-	return err
-}
-
 func Grep(path, token string) (bool, error) {
 	r, err := regexp.Compile(token)
 	if err != nil {
@@ -225,22 +135,62 @@ func PkexecPath() string {
 	return "pkexec"
 }
 
-// RunDetached runs shell command in new process group, effectively unwiring it from parent's one
+// DetachedLogPath returns default log file path for detached command, derived from its executable name
+func DetachedLogPath(command string) (string, error) {
+	argv, err := proc.SplitWords(command)
+	if err != nil {
+		return "", err
+	}
+	if len(argv) == 0 {
+		return "", ErrInvalidCmd{Cmd: command}
+	}
+	return fs.AtDotCache(fmt.Sprintf("toolbox/detached/%s.log", filepath.Base(argv[0]))), nil
+}
+
+// RunDetached runs command in new session, effectively unwiring it from parent's one and its controlling terminal,
 // so this command won't be killed on parent exit
-func RunDetached(command string) error {
+// Command is split into arguments the way shell does, but is not run by shell itself
+// Stdout and stderr are appended to logPath, if provided, and discarded otherwise
+// Returns PID of started process
+func RunDetached(command, logPath string) (int, error) {
+	argv, err := proc.SplitWords(command)
+	if err != nil {
+		return 0, err
+	}
+	if len(argv) == 0 {
+		return 0, ErrInvalidCmd{Cmd: command}
+	}
+	return startDetached(argv, logPath)
+}
+
+func startDetached(argv []string, logPath string) (int, error) {
 	l := logger.Sugar()
-	parts := strings.Split(command, " ")
-	cmd, err := exec.LookPath(parts[0])
+	l.Debugw("[startDetached]", "argv", argv, "logPath", logPath)
+	c := exec.Command(argv[0], argv[1:]...)
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if logPath != "" {
+		err := os.MkdirAll(filepath.Dir(logPath), 0755)
+		if err != nil {
+			return 0, err
+		}
+		logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return 0, err
+		}
+		// NOTE: child gets its own descriptor, so parent's one could be closed right after start
+		defer logFile.Close()
+		c.Stdout = logFile
+		c.Stderr = logFile
+	}
+	err := c.Start()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	attr := &os.ProcAttr{Sys: &syscall.SysProcAttr{Setpgid: true}}
-	argv := append([]string{cmd}, parts[1:]...)
-	process, err := os.StartProcess(cmd, argv, attr)
+	pid := c.Process.Pid
+	l.Debugw("[startDetached]", "pid", pid)
+	err = c.Process.Release()
 	if err != nil {
-		return err
+		return pid, err
 	}
-	l.Debugw("[RunDetached]", "process.Pid", process.Pid)
-	process.Release()
-	return nil
+	return pid, nil
 }
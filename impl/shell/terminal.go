@@ -0,0 +1,379 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/wiedzmin/toolbox/impl"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
+	"github.com/wiedzmin/toolbox/impl/shell/tmux"
+)
+
+const (
+	TerminalBackendKitty     = "kitty"
+	TerminalBackendAlacritty = "alacritty"
+	TerminalBackendWezterm   = "wezterm"
+	TerminalBackendFoot      = "foot"
+	TerminalBackendTmux      = "tmux"
+	TerminalBackendTmuxSplit = "tmux-split"
+	TerminalBackendZellij    = "zellij"
+
+	// NOTE: POSIX sh has no way to read single key, hence switching terminal to non-canonical mode
+	holdCommandTemplate = `%s
+code=$?
+printf '\n[exited with code %%d] press any key to close...' "$code"
+stty -icanon -echo 2>/dev/null
+dd bs=1 count=1 >/dev/null 2>&1
+exit $code`
+)
+
+// TerminalBackend opens terminal windows (or multiplexer panes) and runs commands in them
+// Hold keeps window open after command exits, showing its exit code and waiting for key press, which is needed
+// for transient commands, e.g. `systemctl status`; Title is best-effort, as not every backend is able to set it
+// in every case
+type TerminalBackend interface {
+	Name() string
+	Open(cwd string) error
+	Run(cmd, title, cwd string, hold bool) error
+}
+
+// NewTerminalBackend instantiates terminal backend according to provided traits
+// Unknown backend names are treated as bare terminal command, i.e. `VTermCmd` is run with command appended
+func NewTerminalBackend(traits TerminalTraits) (TerminalBackend, error) {
+	l := logger.Sugar()
+	switch traits.Backend {
+	case TerminalBackendKitty:
+		return &Kitty{}, nil
+	case TerminalBackendAlacritty:
+		return &Alacritty{}, nil
+	case TerminalBackendWezterm:
+		return &Wezterm{}, nil
+	case TerminalBackendFoot:
+		return &Foot{}, nil
+	case TerminalBackendTmux, TerminalBackendTmuxSplit:
+		return &Tmux{Session: traits.TmuxSession, Split: traits.Backend == TerminalBackendTmuxSplit,
+			fallback: &BareTerminal{VTermCmd: traits.VTermCmd}}, nil
+	case TerminalBackendZellij:
+		return &Zellij{Session: traits.TmuxSession}, nil
+	default:
+		l.Debugw("[NewTerminalBackend]", "backend", traits.Backend, "summary", "unknown terminal backend, using bare terminal command")
+		if len(traits.VTermCmd) == 0 {
+			return nil, ErrInvalidCmd{Cmd: traits.VTermCmd}
+		}
+		return &BareTerminal{VTermCmd: traits.VTermCmd}, nil
+	}
+}
+
+func OpenTerminal(path string, traits TerminalTraits) error {
+	backend, err := NewTerminalBackend(traits)
+	if err != nil {
+		return err
+	}
+	return backend.Open(path)
+}
+
+func RunInTerminal(cmd, title string, traits TerminalTraits) error {
+	backend, err := NewTerminalBackend(traits)
+	if err != nil {
+		return err
+	}
+	return backend.Run(cmd, title, "", traits.Hold)
+}
+
+// HoldCommand wraps shell command, so that terminal it runs in is kept open after it exits
+func HoldCommand(cmd string) string {
+	return fmt.Sprintf(holdCommandTemplate, cmd)
+}
+
+// shellArgv wraps command into argv suitable for terminals, which run program directly rather than via shell
+// NOTE: holding is implemented uniformly rather than with terminals' own options (like `--hold`), as none of those
+// show exit code, and some terminals lack such option at all
+func shellArgv(cmd string, hold bool) []string {
+	if hold {
+		cmd = HoldCommand(cmd)
+	}
+	return []string{"sh", "-c", cmd}
+}
+
+func run(argv []string) error {
+	return proc.Run(context.Background(), argv, proc.Options{})
+}
+
+// Kitty talks to running instance over remote control socket, starting new instance if none is listening
+type Kitty struct{}
+
+func (k *Kitty) Name() string {
+	return TerminalBackendKitty
+}
+
+func (k *Kitty) socket() (string, error) {
+	socket := os.Getenv(KittySocketEnvVarName)
+	if socket == "" {
+		return "", ErrNoEnvVar{Name: KittySocketEnvVarName}
+	}
+	return socket, nil
+}
+
+func (k *Kitty) Open(cwd string) error {
+	l := logger.Sugar()
+	impl.EnsureBinary("kitty", *logger)
+	l.Debugw("[Kitty.Open]", "cwd", cwd)
+	socket, err := k.socket()
+	if err != nil {
+		return err
+	}
+	err = run([]string{"kitty", "@", "--to", socket, "launch", "--cwd", cwd, "--type", "os-window"})
+	if err != nil {
+		// NOTE: most likely, kitty is not running, hence no socket listening - let's start new instance with required CWD
+		_, err = startDetached([]string{"kitty", "--working-directory", cwd}, "")
+	}
+	return err
+}
+
+func (k *Kitty) Run(cmd, title, cwd string, hold bool) error {
+	l := logger.Sugar()
+	impl.EnsureBinary("kitty", *logger)
+	l.Debugw("[Kitty.Run]", "cmd", cmd, "title", title, "cwd", cwd, "hold", hold)
+	socket, err := k.socket()
+	if err != nil {
+		return err
+	}
+	argv := []string{"kitty", "@", "--to", socket, "launch", "--type", "os-window"}
+	if title != "" {
+		argv = append(argv, "--title", title)
+	}
+	if cwd != "" {
+		argv = append(argv, "--cwd", cwd)
+	}
+	return run(append(argv, shellArgv(cmd, hold)...))
+}
+
+type Alacritty struct{}
+
+func (a *Alacritty) Name() string {
+	return TerminalBackendAlacritty
+}
+
+func (a *Alacritty) Open(cwd string) error {
+	impl.EnsureBinary("alacritty", *logger)
+	_, err := startDetached([]string{"alacritty", "--working-directory", cwd}, "")
+	return err
+}
+
+func (a *Alacritty) Run(cmd, title, cwd string, hold bool) error {
+	l := logger.Sugar()
+	impl.EnsureBinary("alacritty", *logger)
+	l.Debugw("[Alacritty.Run]", "cmd", cmd, "title", title, "cwd", cwd, "hold", hold)
+	argv := []string{"alacritty"}
+	if title != "" {
+		argv = append(argv, "--title", title)
+	}
+	if cwd != "" {
+		argv = append(argv, "--working-directory", cwd)
+	}
+	argv = append(argv, "-e")
+	_, err := startDetached(append(argv, shellArgv(cmd, hold)...), "")
+	return err
+}
+
+// Wezterm spawns windows in running instance via its CLI, starting new instance if there is none
+type Wezterm struct{}
+
+func (w *Wezterm) Name() string {
+	return TerminalBackendWezterm
+}
+
+func (w *Wezterm) Open(cwd string) error {
+	impl.EnsureBinary("wezterm", *logger)
+	err := run([]string{"wezterm", "cli", "spawn", "--new-window", "--cwd", cwd})
+	if err != nil {
+		_, err = startDetached([]string{"wezterm", "start", "--cwd", cwd}, "")
+	}
+	return err
+}
+
+func (w *Wezterm) Run(cmd, title, cwd string, hold bool) error {
+	l := logger.Sugar()
+	impl.EnsureBinary("wezterm", *logger)
+	l.Debugw("[Wezterm.Run]", "cmd", cmd, "title", title, "cwd", cwd, "hold", hold)
+	var cwdArgs []string
+	if cwd != "" {
+		cwdArgs = []string{"--cwd", cwd}
+	}
+	argv := append(append([]string{"wezterm", "cli", "spawn", "--new-window"}, cwdArgs...), "--")
+	paneID, err := proc.Output(context.Background(), append(argv, shellArgv(cmd, hold)...), proc.Options{})
+	if err != nil {
+		// NOTE: there is no running instance to ask for title, so it is left as is
+		argv = append(append([]string{"wezterm", "start"}, cwdArgs...), "--")
+		_, err = startDetached(append(argv, shellArgv(cmd, hold)...), "")
+		return err
+	}
+	// NOTE: wezterm has no option for setting title on spawn, so it is set afterwards, by pane id spawn reports
+	if title != "" {
+		err = run([]string{"wezterm", "cli", "set-tab-title", "--pane-id", strings.TrimSpace(paneID), title})
+		if err != nil {
+			l.Warnw("[Wezterm.Run]", "title", title, "pane", paneID, "err", err)
+		}
+	}
+	return nil
+}
+
+type Foot struct{}
+
+func (f *Foot) Name() string {
+	return TerminalBackendFoot
+}
+
+func (f *Foot) Open(cwd string) error {
+	impl.EnsureBinary("foot", *logger)
+	_, err := startDetached([]string{"foot", "--working-directory", cwd}, "")
+	return err
+}
+
+func (f *Foot) Run(cmd, title, cwd string, hold bool) error {
+	l := logger.Sugar()
+	impl.EnsureBinary("foot", *logger)
+	l.Debugw("[Foot.Run]", "cmd", cmd, "title", title, "cwd", cwd, "hold", hold)
+	argv := []string{"foot"}
+	if title != "" {
+		argv = append(argv, "--title", title)
+	}
+	if cwd != "" {
+		argv = append(argv, "--working-directory", cwd)
+	}
+	_, err := startDetached(append(argv, shellArgv(cmd, hold)...), "")
+	return err
+}
+
+// Tmux opens new windows (or splits current one, if Split is set) in provided session
+// If there is no such session, fallback backend is used
+type Tmux struct {
+	Session  string
+	Split    bool
+	fallback TerminalBackend
+}
+
+func (t *Tmux) Name() string {
+	if t.Split {
+		return TerminalBackendTmuxSplit
+	}
+	return TerminalBackendTmux
+}
+
+func (t *Tmux) session() (*tmux.Session, error) {
+	l := logger.Sugar()
+	if len(t.Session) == 0 {
+		return nil, tmux.ErrSessionNotFound{Name: t.Session}
+	}
+	impl.EnsureBinary("tmux", *logger)
+	session, err := tmux.GetSession(t.Session, false, false)
+	l.Debugw("[Tmux.session]", "name", t.Session, "err", err)
+	return session, err
+}
+
+func (t *Tmux) Open(cwd string) error {
+	return t.Run("exec ${SHELL:-sh}", "", cwd, false)
+}
+
+func (t *Tmux) Run(cmd, title, cwd string, hold bool) error {
+	session, err := t.session()
+	switch err.(type) {
+	case tmux.ErrSessionNotFound:
+		if t.fallback == nil {
+			return err
+		}
+		return t.fallback.Run(cmd, title, cwd, hold)
+	default:
+		if err != nil {
+			return err
+		}
+	}
+	if hold {
+		cmd = HoldCommand(cmd)
+	}
+	if t.Split {
+		return session.SplitWindow(cmd, cwd, true)
+	}
+	return session.NewWindow(cmd, title, cwd, true)
+}
+
+// Zellij opens panes in provided session, or in current one, if none is provided
+type Zellij struct {
+	Session string
+}
+
+func (z *Zellij) Name() string {
+	return TerminalBackendZellij
+}
+
+func (z *Zellij) argv(args ...string) []string {
+	argv := []string{"zellij"}
+	if z.Session != "" {
+		argv = append(argv, "--session", z.Session)
+	}
+	return append(argv, args...)
+}
+
+func (z *Zellij) Open(cwd string) error {
+	impl.EnsureBinary("zellij", *logger)
+	return run(z.argv("action", "new-pane", "--cwd", cwd))
+}
+
+func (z *Zellij) Run(cmd, title, cwd string, hold bool) error {
+	l := logger.Sugar()
+	impl.EnsureBinary("zellij", *logger)
+	l.Debugw("[Zellij.Run]", "cmd", cmd, "title", title, "cwd", cwd, "hold", hold)
+	args := []string{"run"}
+	if title != "" {
+		args = append(args, "--name", title)
+	}
+	if cwd != "" {
+		args = append(args, "--cwd", cwd)
+	}
+	// NOTE: zellij keeps exited command panes open on its own, which is superseded by uniform holding
+	args = append(args, "--close-on-exit", "--")
+	return run(append(z.argv(args...), shellArgv(cmd, hold)...))
+}
+
+// BareTerminal runs arbitrary terminal command, e.g. "xterm -e", with command to run appended to it
+type BareTerminal struct {
+	VTermCmd string
+}
+
+func (b *BareTerminal) Name() string {
+	return b.VTermCmd
+}
+
+func (b *BareTerminal) argv() ([]string, error) {
+	argv, err := proc.SplitWords(b.VTermCmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(argv) == 0 {
+		return nil, ErrInvalidCmd{Cmd: b.VTermCmd}
+	}
+	return argv, nil
+}
+
+func (b *BareTerminal) Open(cwd string) error {
+	// NOTE: because VT programs has no agreement on syntax for just opening new
+	// window/pane with particular CWD, we could not relay on any defaults for this,
+	// so interactive shell is started in required directory instead
+	return b.Run("exec ${SHELL:-sh}", "", cwd, false)
+}
+
+func (b *BareTerminal) Run(cmd, title, cwd string, hold bool) error {
+	l := logger.Sugar()
+	argv, err := b.argv()
+	if err != nil {
+		return err
+	}
+	if cwd != "" {
+		cmd = fmt.Sprintf("cd %s && %s", proc.QuoteWord(cwd), cmd)
+	}
+	l.Debugw("[BareTerminal.Run]", "argv", argv, "cmd", cmd, "title", title, "hold", hold)
+	_, err = startDetached(append(argv, shellArgv(cmd, hold)...), "")
+	return err
+}
@@ -0,0 +1,127 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
+)
+
+func TestNewTerminalBackend(t *testing.T) {
+	tests := []struct {
+		traits TerminalTraits
+		name   string
+	}{
+		{TerminalTraits{Backend: TerminalBackendKitty}, TerminalBackendKitty},
+		{TerminalTraits{Backend: TerminalBackendAlacritty}, TerminalBackendAlacritty},
+		{TerminalTraits{Backend: TerminalBackendWezterm}, TerminalBackendWezterm},
+		{TerminalTraits{Backend: TerminalBackendFoot}, TerminalBackendFoot},
+		{TerminalTraits{Backend: TerminalBackendTmux, TmuxSession: "main"}, TerminalBackendTmux},
+		{TerminalTraits{Backend: TerminalBackendTmuxSplit, TmuxSession: "main"}, TerminalBackendTmuxSplit},
+		{TerminalTraits{Backend: TerminalBackendZellij}, TerminalBackendZellij},
+		{TerminalTraits{Backend: "xterm", VTermCmd: "xterm -e"}, "xterm -e"},
+		{TerminalTraits{VTermCmd: "st -e"}, "st -e"},
+	}
+	for _, tt := range tests {
+		backend, err := NewTerminalBackend(tt.traits)
+		if err != nil {
+			t.Errorf("NewTerminalBackend(%+v): unexpected error: %v", tt.traits, err)
+			continue
+		}
+		if got := backend.Name(); got != tt.name {
+			t.Errorf("NewTerminalBackend(%+v).Name() = %s, want %s", tt.traits, got, tt.name)
+		}
+	}
+
+	backend, err := NewTerminalBackend(TerminalTraits{Backend: TerminalBackendTmuxSplit, TmuxSession: "main", VTermCmd: "xterm -e"})
+	if err != nil {
+		t.Fatalf("NewTerminalBackend(tmux-split): unexpected error: %v", err)
+	}
+	tmux, ok := backend.(*Tmux)
+	if !ok || tmux.Session != "main" || !tmux.Split || tmux.fallback == nil || tmux.fallback.Name() != "xterm -e" {
+		t.Errorf("NewTerminalBackend(tmux-split) = %+v", backend)
+	}
+
+	var invalid ErrInvalidCmd
+	_, err = NewTerminalBackend(TerminalTraits{Backend: "unknown"})
+	if !errors.As(err, &invalid) {
+		t.Errorf("NewTerminalBackend(unknown, no command): got error %v, want ErrInvalidCmd", err)
+	}
+}
+
+func TestShellArgv(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		hold bool
+		want []string
+	}{
+		{"htop", false, []string{"sh", "-c", "htop"}},
+		{"systemctl status 'a b'", false, []string{"sh", "-c", "systemctl status 'a b'"}},
+		{"make", true, []string{"sh", "-c", HoldCommand("make")}},
+	}
+	for _, tt := range tests {
+		if got := shellArgv(tt.cmd, tt.hold); !slices.Equal(got, tt.want) {
+			t.Errorf("shellArgv(%q, %v) = %q, want %q", tt.cmd, tt.hold, got, tt.want)
+		}
+	}
+}
+
+func TestHoldCommand(t *testing.T) {
+	// NOTE: with no terminal attached, waiting for key press ends on stdin EOF right away
+	empty := ""
+	out, err := proc.Output(context.Background(), shellArgv("echo done; (exit 3)", true), proc.Options{Stdin: &empty})
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("held command: got error %v, want exit code 3", err)
+	}
+	if !strings.HasPrefix(out, "done\n") || !strings.Contains(out, "[exited with code 3]") {
+		t.Errorf("held command output = %q", out)
+	}
+}
+
+func TestZellijArgv(t *testing.T) {
+	z := Zellij{}
+	if got, want := z.argv("action", "new-pane"), []string{"zellij", "action", "new-pane"}; !slices.Equal(got, want) {
+		t.Errorf("argv = %q, want %q", got, want)
+	}
+	z.Session = "work"
+	if got, want := z.argv("run", "--"), []string{"zellij", "--session", "work", "run", "--"}; !slices.Equal(got, want) {
+		t.Errorf("argv with session = %q, want %q", got, want)
+	}
+}
+
+func TestBareTerminalArgv(t *testing.T) {
+	tests := []struct {
+		vtermCmd string
+		want     []string
+	}{
+		{"xterm -e", []string{"xterm", "-e"}},
+		{"st -t 'my term' -e", []string{"st", "-t", "my term", "-e"}},
+	}
+	for _, tt := range tests {
+		b := BareTerminal{VTermCmd: tt.vtermCmd}
+		got, err := b.argv()
+		if err != nil {
+			t.Errorf("argv(%q): unexpected error: %v", tt.vtermCmd, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("argv(%q) = %q, want %q", tt.vtermCmd, got, tt.want)
+		}
+	}
+
+	var invalid ErrInvalidCmd
+	b := BareTerminal{VTermCmd: "   "}
+	if _, err := b.argv(); !errors.As(err, &invalid) {
+		t.Errorf("argv(blank): got error %v, want ErrInvalidCmd", err)
+	}
+	var unterminated proc.ErrUnterminated
+	b = BareTerminal{VTermCmd: "st -t 'oops -e"}
+	if _, err := b.argv(); !errors.As(err, &unterminated) {
+		t.Errorf("argv(unterminated): got error %v, want ErrUnterminated", err)
+	}
+}
@@ -1,20 +1,78 @@
 package tmux
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/wiedzmin/toolbox/impl"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
 	"go.uber.org/zap"
 )
 
 const (
 	SessionFlagName = "tmux-session"
+
+	// NOTE: tmux replaces non-printable characters in formats output, so separator should be printable,
+	// yet unlikely to appear in names
+	fieldsSeparator = "|~|"
+
+	sessionFormat = "#{session_id}|~|#{session_name}|~|#{session_windows}|~|#{session_attached}|~|" +
+		"#{session_created}|~|#{session_activity}|~|#{session_path}"
+	windowFormat = "#{window_id}|~|#{window_index}|~|#{window_name}|~|#{session_name}|~|#{window_active}|~|" +
+		"#{window_panes}|~|#{window_activity}|~|#{window_layout}"
+	paneFormat = "#{pane_id}|~|#{pane_index}|~|#{session_name}|~|#{window_id}|~|#{window_index}|~|#{pane_active}|~|" +
+		"#{pane_current_path}|~|#{pane_current_command}|~|#{pane_pid}|~|#{window_activity}"
+)
+
+// NOTE: tmux has no dedicated exit codes, so errors are recognized by their messages
+var (
+	serverNotRunningMessages = []string{"no server running", "error connecting to", "server exited unexpectedly"}
+	sessionNotFoundMessages  = []string{"can't find session", "session not found"}
+	targetNotFoundMessages   = []string{"can't find window", "can't find pane", "no such window", "no such pane"}
+
+	shells = []string{"sh", "bash", "zsh", "fish", "dash", "ksh", "tcsh", "nu", "xonsh"}
 )
 
 type Session struct {
-	Name string
+	ID           string
+	Name         string
+	WindowsCount int
+	Attached     bool
+	Created      time.Time
+	Activity     time.Time
+	Path         string
+}
+
+type Window struct {
+	ID         string
+	Index      int
+	Name       string
+	Session    string
+	Active     bool
+	PanesCount int
+	Activity   time.Time
+	Layout     string
+}
+
+// Pane is a tmux pane, its Activity is the one of enclosing window, as tmux does not track panes activity
+type Pane struct {
+	ID          string
+	Index       int
+	Session     string
+	WindowID    string
+	WindowIndex int
+	Active      bool
+	Path        string
+	Command     string
+	PID         int
+	Activity    time.Time
 }
 
 type ErrSessionNotFound struct {
@@ -22,7 +80,31 @@ type ErrSessionNotFound struct {
 }
 
 func (e ErrSessionNotFound) Error() string {
-	return fmt.Sprintf("tmuxp: session '%s' not exist", e.Name)
+	return fmt.Sprintf("tmux: session '%s' not exist", e.Name)
+}
+
+type ErrTargetNotFound struct {
+	Target string
+}
+
+func (e ErrTargetNotFound) Error() string {
+	return fmt.Sprintf("tmux: target '%s' not found", e.Target)
+}
+
+type ErrServerNotRunning struct {
+	Message string
+}
+
+func (e ErrServerNotRunning) Error() string {
+	return fmt.Sprintf("tmux: server is not running: %s", e.Message)
+}
+
+type ErrUnexpectedOutput struct {
+	Line string
+}
+
+func (e ErrUnexpectedOutput) Error() string {
+	return fmt.Sprintf("tmux: unexpected output: '%s'", e.Line)
 }
 
 var logger *zap.Logger
@@ -31,62 +113,446 @@ func init() {
 	logger = impl.NewLogger()
 }
 
-func GetSession(name string, create, attach bool) (*Session, error) {
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyErr turns tmux failures into typed errors, where possible
+func classifyErr(err error, target string) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	message := strings.TrimSpace(string(exitErr.Stderr))
+	switch {
+	case containsAny(message, serverNotRunningMessages):
+		return ErrServerNotRunning{Message: message}
+	case containsAny(message, sessionNotFoundMessages):
+		return ErrSessionNotFound{Name: target}
+	case containsAny(message, targetNotFoundMessages):
+		return ErrTargetNotFound{Target: target}
+	case message != "":
+		return fmt.Errorf("tmux: %s", message)
+	}
+	return err
+}
+
+// run runs tmux command, target is only used for error reporting
+func run(target string, args ...string) (string, error) {
 	l := logger.Sugar()
-	l.Debugw("[GetSession]", "name", name, "create", create, "attach", attach)
-	c := exec.Command("sh", "-c", fmt.Sprintf("tmux has-session -t %s", name))
-	out, err := c.Output()
-	outStr := strings.TrimRight(string(out), "\n")
-	l.Debugw("[GetSession]", "out", out, "err", err)
+	out, err := proc.Output(context.Background(), append([]string{"tmux"}, args...), proc.Options{})
+	if err != nil {
+		l.Debugw("[run]", "args", args, "err", err)
+		return "", classifyErr(err, target)
+	}
+	return out, nil
+}
+
+func parseLines(out string, fieldsCount int, parseFn func([]string) error) error {
+	if out == "" {
+		return nil
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, fieldsSeparator)
+		if len(fields) != fieldsCount {
+			return ErrUnexpectedOutput{Line: line}
+		}
+		err := parseFn(fields)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseTimestamp(s string) time.Time {
+	ts, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts, 0)
+}
+
+func parseSession(fields []string) Session {
+	windows, _ := strconv.Atoi(fields[2])
+	attached, _ := strconv.Atoi(fields[3])
+	return Session{
+		ID:           fields[0],
+		Name:         fields[1],
+		WindowsCount: windows,
+		Attached:     attached > 0,
+		Created:      parseTimestamp(fields[4]),
+		Activity:     parseTimestamp(fields[5]),
+		Path:         fields[6],
+	}
+}
+
+func parseWindow(fields []string) Window {
+	index, _ := strconv.Atoi(fields[1])
+	panes, _ := strconv.Atoi(fields[5])
+	return Window{
+		ID:         fields[0],
+		Index:      index,
+		Name:       fields[2],
+		Session:    fields[3],
+		Active:     fields[4] == "1",
+		PanesCount: panes,
+		Activity:   parseTimestamp(fields[6]),
+		Layout:     fields[7],
+	}
+}
+
+func parsePane(fields []string) Pane {
+	index, _ := strconv.Atoi(fields[1])
+	windowIndex, _ := strconv.Atoi(fields[4])
+	pid, _ := strconv.Atoi(fields[8])
+	return Pane{
+		ID:          fields[0],
+		Index:       index,
+		Session:     fields[2],
+		WindowID:    fields[3],
+		WindowIndex: windowIndex,
+		Active:      fields[5] == "1",
+		Path:        fields[6],
+		Command:     fields[7],
+		PID:         pid,
+		Activity:    parseTimestamp(fields[9]),
+	}
+}
+
+// InsideTmux reports if current process runs inside tmux client
+func InsideTmux() bool {
+	return os.Getenv("TMUX") != ""
+}
+
+// CurrentSession returns name of the session current process runs in, empty one when running outside of tmux
+func CurrentSession() (string, error) {
+	if !InsideTmux() {
+		return "", nil
+	}
+	args := []string{"display-message", "-p"}
+	// NOTE: with no target, tmux reports session of the most recently active client, which is not necessarily ours
+	if pane := os.Getenv("TMUX_PANE"); pane != "" {
+		args = append(args, "-t", pane)
+	}
+	return run("", append(args, "#{session_name}")...)
+}
+
+// ListSessions returns all sessions of running server
+// ErrServerNotRunning is returned if there is no server, which could be treated as no sessions at all
+func ListSessions() ([]Session, error) {
+	out, err := run("", "list-sessions", "-F", sessionFormat)
+	if err != nil {
+		return nil, err
+	}
+	var result []Session
+	err = parseLines(out, strings.Count(sessionFormat, fieldsSeparator)+1, func(fields []string) error {
+		result = append(result, parseSession(fields))
+		return nil
+	})
+	return result, err
+}
+
+// ListWindows returns windows of provided session, or of all sessions if name is empty
+func ListWindows(session string) ([]Window, error) {
+	args := []string{"list-windows", "-F", windowFormat}
+	if session == "" {
+		args = append(args, "-a")
+	} else {
+		args = append(args, "-t", session)
+	}
+	out, err := run(session, args...)
+	if err != nil {
+		return nil, err
+	}
+	var result []Window
+	err = parseLines(out, strings.Count(windowFormat, fieldsSeparator)+1, func(fields []string) error {
+		result = append(result, parseWindow(fields))
+		return nil
+	})
+	return result, err
+}
+
+// ListPanes returns panes of provided session, or of all sessions if name is empty
+func ListPanes(session string) ([]Pane, error) {
+	args := []string{"list-panes", "-F", paneFormat}
+	if session == "" {
+		args = append(args, "-a")
+	} else {
+		args = append(args, "-s", "-t", session)
+	}
+	out, err := run(session, args...)
 	if err != nil {
 		return nil, err
 	}
-	if len(outStr) > 0 {
-		if create {
-			c = exec.Command("sh", "-c", fmt.Sprintf("tmux new-session -d -s %s", name))
-			err := c.Run()
-			if err != nil {
-				return nil, err
-			}
-			c = exec.Command("sh", "-c", fmt.Sprintf("tmux switch-client -t %s", name))
-			err = c.Run()
-			if err != nil {
-				return nil, err
-			}
-			return &Session{Name: name}, nil
-		} else {
+	var result []Pane
+	err = parseLines(out, strings.Count(paneFormat, fieldsSeparator)+1, func(fields []string) error {
+		result = append(result, parsePane(fields))
+		return nil
+	})
+	return result, err
+}
+
+// HasSession checks if session exists, missing server means no session
+func HasSession(name string) (bool, error) {
+	// NOTE: "=" prefix disables prefix matching of session names
+	_, err := run(name, "has-session", "-t", "="+name)
+	switch err.(type) {
+	case nil:
+		return true, nil
+	case ErrSessionNotFound, ErrServerNotRunning:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// NewSession creates detached session, starting server if needed
+func NewSession(name, startDirectory string) (*Session, error) {
+	args := []string{"new-session", "-d", "-P", "-F", sessionFormat, "-s", name}
+	if startDirectory != "" {
+		args = append(args, "-c", startDirectory)
+	}
+	out, err := run(name, args...)
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	err = parseLines(out, strings.Count(sessionFormat, fieldsSeparator)+1, func(fields []string) error {
+		session = parseSession(fields)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func lookupSession(name string) (*Session, error) {
+	sessions, err := ListSessions()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		if s.Name == name {
+			return &s, nil
+		}
+	}
+	return nil, ErrSessionNotFound{Name: name}
+}
+
+// GetSession returns existing session, optionally creating it if not exists
+// Attaching only makes sense inside tmux client, otherwise it is silently skipped
+func GetSession(name string, create, attach bool) (*Session, error) {
+	l := logger.Sugar()
+	l.Debugw("[GetSession]", "name", name, "create", create, "attach", attach)
+	session, err := lookupSession(name)
+	switch err.(type) {
+	case nil:
+	case ErrSessionNotFound, ErrServerNotRunning:
+		if !create {
 			return nil, ErrSessionNotFound{Name: name}
 		}
+		session, err = NewSession(name, "")
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	if attach && InsideTmux() {
+		err = session.Switch()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+func (s *Session) target() string {
+	return "=" + s.Name
+}
+
+// Switch makes current client show the session
+func (s *Session) Switch() error {
+	_, err := run(s.Name, "switch-client", "-t", s.target())
+	return err
+}
+
+func (s *Session) Kill() error {
+	_, err := run(s.Name, "kill-session", "-t", s.target())
+	return err
+}
+
+func (s *Session) Rename(name string) error {
+	_, err := run(s.Name, "rename-session", "-t", s.target(), name)
+	if err != nil {
+		return err
 	}
-	return &Session{Name: name}, nil
+	s.Name = name
+	return nil
+}
+
+func (s *Session) ListWindows() ([]Window, error) {
+	return ListWindows(s.target())
+}
+
+func (s *Session) ListPanes() ([]Pane, error) {
+	return ListPanes(s.target())
 }
 
 func (s *Session) NewWindow(cmd, title, startDirectory string, attach bool) error {
 	l := logger.Sugar()
-	args := []string{
-		fmt.Sprintf("-t %s", s.Name),
-		fmt.Sprintf("-n '%s'", title),
-	}
+	// NOTE: trailing colon makes tmux treat target as session, rather than window
+	args := []string{"new-window", "-t", s.target() + ":", "-n", title}
 	l.Debugw(fmt.Sprintf("[%s.NewWindow]", s.Name), "cmd", cmd, "title", title, "startDirectory", startDirectory, "attach", attach)
-	var argsStr strings.Builder
 	if !attach {
 		args = append(args, "-d")
 	}
 	if len(startDirectory) > 0 {
-		args = append(args, fmt.Sprintf("-c %s", startDirectory))
+		args = append(args, "-c", startDirectory)
 	}
-	// TODO: elaborate/ensure `transient` commands proper handling, i.e. those who need "; read" thereafter
-	args = append(args, fmt.Sprintf("\"%s\"", cmd))
-	for _, arg := range args {
-		argsStr.WriteString(fmt.Sprintf("%s ", arg))
+	// NOTE: tmux runs single-argument command with shell on its own, so cmd is passed intact
+	// NOTE: transient commands are expected to be wrapped by caller, see shell.HoldCommand
+	if cmd != "" {
+		args = append(args, cmd)
 	}
+	_, err := run(s.Name, args...)
+	return err
+}
+
+// SplitWindow splits current window of session, running cmd in the new pane
+func (s *Session) SplitWindow(cmd, startDirectory string, horizontal bool) error {
+	return splitWindow(s.target()+":", s.Name, cmd, startDirectory, horizontal)
+}
 
-	tmuxCmd := fmt.Sprintf("tmux new-window %s", strings.TrimSpace(argsStr.String()))
-	l.Debugw(fmt.Sprintf("[%s.NewWindow]", s.Name), "tmuxCmd", tmuxCmd)
-	c := exec.Command("sh", "-c", tmuxCmd)
-	err := c.Run()
+func splitWindow(target, name, cmd, startDirectory string, horizontal bool) error {
+	l := logger.Sugar()
+	args := []string{"split-window", "-t", target}
+	if horizontal {
+		args = append(args, "-h")
+	} else {
+		args = append(args, "-v")
+	}
+	if len(startDirectory) > 0 {
+		args = append(args, "-c", startDirectory)
+	}
+	if cmd != "" {
+		args = append(args, cmd)
+	}
+	l.Debugw("[splitWindow]", "target", target, "args", args)
+	_, err := run(name, args...)
+	return err
+}
+
+func (w *Window) Select() error {
+	_, err := run(w.ID, "select-window", "-t", w.ID)
+	return err
+}
+
+func (w *Window) Kill() error {
+	_, err := run(w.ID, "kill-window", "-t", w.ID)
+	return err
+}
+
+func (w *Window) Rename(name string) error {
+	_, err := run(w.ID, "rename-window", "-t", w.ID, name)
 	if err != nil {
 		return err
 	}
+	w.Name = name
 	return nil
 }
+
+func (w *Window) Split(cmd, startDirectory string, horizontal bool) error {
+	return splitWindow(w.ID, w.ID, cmd, startDirectory, horizontal)
+}
+
+func (w *Window) ListPanes() ([]Pane, error) {
+	out, err := run(w.ID, "list-panes", "-t", w.ID, "-F", paneFormat)
+	if err != nil {
+		return nil, err
+	}
+	var result []Pane
+	err = parseLines(out, strings.Count(paneFormat, fieldsSeparator)+1, func(fields []string) error {
+		result = append(result, parsePane(fields))
+		return nil
+	})
+	return result, err
+}
+
+func (p *Pane) Select() error {
+	_, err := run(p.ID, "select-pane", "-t", p.ID)
+	return err
+}
+
+func (p *Pane) Kill() error {
+	_, err := run(p.ID, "kill-pane", "-t", p.ID)
+	return err
+}
+
+func (p *Pane) Split(cmd, startDirectory string, horizontal bool) error {
+	return splitWindow(p.ID, p.ID, cmd, startDirectory, horizontal)
+}
+
+// SendKeys sends keys to pane, literal ones are sent as is, otherwise key names like "Enter" or "C-c" are recognized
+func (p *Pane) SendKeys(literal bool, keys ...string) error {
+	args := []string{"send-keys", "-t", p.ID}
+	if literal {
+		args = append(args, "-l")
+	}
+	_, err := run(p.ID, append(args, keys...)...)
+	return err
+}
+
+// Capture returns pane contents, with wrapped lines joined
+// start and end are line numbers, as per `capture-pane -S/-E`, negative ones refer to history, "-" means its bounds
+func (p *Pane) Capture(start, end string) (string, error) {
+	args := []string{"capture-pane", "-p", "-J", "-t", p.ID}
+	if start != "" {
+		args = append(args, "-S", start)
+	}
+	if end != "" {
+		args = append(args, "-E", end)
+	}
+	return run(p.ID, args...)
+}
+
+// Idle reports if pane runs nothing but interactive shell
+func (p *Pane) Idle() bool {
+	for _, sh := range shells {
+		if p.Command == sh {
+			return true
+		}
+	}
+	return false
+}
+
+// ForegroundCommand returns full command line of process, pane is currently running in foreground
+// Nil is returned for idle panes
+// NOTE: relies on procfs, so it is Linux-only
+func (p *Pane) ForegroundCommand() ([]string, error) {
+	if p.Idle() {
+		return nil, nil
+	}
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(p.PID), "stat"))
+	if err != nil {
+		return nil, err
+	}
+	// NOTE: process name could contain spaces and parens, so fields are counted from its closing paren
+	// tpgid is the 8th field of stat, i.e. the 6th after name
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	if len(fields) < 6 {
+		return nil, ErrUnexpectedOutput{Line: string(stat)}
+	}
+	cmdline, err := os.ReadFile(filepath.Join("/proc", fields[5], "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00"), nil
+}
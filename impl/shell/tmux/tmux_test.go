@@ -0,0 +1,165 @@
+package tmux
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func joinFields(fields ...string) string {
+	return strings.Join(fields, fieldsSeparator)
+}
+
+func TestParseSessions(t *testing.T) {
+	out := strings.Join([]string{
+		joinFields("$0", "main", "3", "1", "1700000000", "1700000100", "/home/user"),
+		joinFields("$1", "with spaces | and bars", "1", "0", "0", "", ""),
+	}, "\n")
+	want := []Session{
+		{ID: "$0", Name: "main", WindowsCount: 3, Attached: true,
+			Created: time.Unix(1700000000, 0), Activity: time.Unix(1700000100, 0), Path: "/home/user"},
+		{ID: "$1", Name: "with spaces | and bars", WindowsCount: 1},
+	}
+	var got []Session
+	err := parseLines(out, strings.Count(sessionFormat, fieldsSeparator)+1, func(fields []string) error {
+		got = append(got, parseSession(fields))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("parseLines: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed sessions = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	out := joinFields("@4", "2", "editor", "main", "1", "2", "1700000200", "b25d,80x24,0,0{40x24,0,0,1,39x24,41,0,2}")
+	want := []Window{
+		{ID: "@4", Index: 2, Name: "editor", Session: "main", Active: true, PanesCount: 2,
+			Activity: time.Unix(1700000200, 0), Layout: "b25d,80x24,0,0{40x24,0,0,1,39x24,41,0,2}"},
+	}
+	var got []Window
+	err := parseLines(out, strings.Count(windowFormat, fieldsSeparator)+1, func(fields []string) error {
+		got = append(got, parseWindow(fields))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("parseLines: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed windows = %+v, want %+v", got, want)
+	}
+}
+
+func TestParsePanes(t *testing.T) {
+	out := strings.Join([]string{
+		joinFields("%1", "0", "main", "@4", "2", "1", "/home/user/src", "nvim", "12345", "1700000200"),
+		joinFields("%2", "1", "main", "@4", "2", "0", "/tmp", "zsh", "12346", "1700000200"),
+	}, "\n")
+	want := []Pane{
+		{ID: "%1", Index: 0, Session: "main", WindowID: "@4", WindowIndex: 2, Active: true,
+			Path: "/home/user/src", Command: "nvim", PID: 12345, Activity: time.Unix(1700000200, 0)},
+		{ID: "%2", Index: 1, Session: "main", WindowID: "@4", WindowIndex: 2,
+			Path: "/tmp", Command: "zsh", PID: 12346, Activity: time.Unix(1700000200, 0)},
+	}
+	var got []Pane
+	err := parseLines(out, strings.Count(paneFormat, fieldsSeparator)+1, func(fields []string) error {
+		got = append(got, parsePane(fields))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("parseLines: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed panes = %+v, want %+v", got, want)
+	}
+}
+
+func TestPaneIdle(t *testing.T) {
+	for _, command := range []string{"zsh", "bash", "fish"} {
+		p := Pane{Command: command}
+		if !p.Idle() {
+			t.Errorf("Pane{Command: %s}.Idle() = false, want true", command)
+		}
+		// NOTE: idle panes are not inspected any further, so there is no need for live process
+		argv, err := p.ForegroundCommand()
+		if argv != nil || err != nil {
+			t.Errorf("Pane{Command: %s}.ForegroundCommand() = %q, %v, want nothing", command, argv, err)
+		}
+	}
+	for _, command := range []string{"nvim", "zshell", "ssh"} {
+		p := Pane{Command: command}
+		if p.Idle() {
+			t.Errorf("Pane{Command: %s}.Idle() = true, want false", command)
+		}
+	}
+}
+
+func TestParseLinesMalformed(t *testing.T) {
+	calls := 0
+	count := func([]string) error {
+		calls++
+		return nil
+	}
+	err := parseLines("", 3, count)
+	if err != nil || calls != 0 {
+		t.Errorf("parseLines(empty): got %d calls and error %v, want none", calls, err)
+	}
+
+	tests := []string{
+		"no separators at all",
+		joinFields("too", "few"),
+		joinFields("far", "too", "many", "fields"),
+		joinFields("a", "b", "c") + "\n" + joinFields("a", "b"),
+	}
+	for _, out := range tests {
+		err := parseLines(out, 3, count)
+		var unexpected ErrUnexpectedOutput
+		if !errors.As(err, &unexpected) {
+			t.Errorf("parseLines(%q): got error %v, want ErrUnexpectedOutput", out, err)
+		}
+	}
+
+	failing := errors.New("failing")
+	err = parseLines(joinFields("a", "b", "c"), 3, func([]string) error { return failing })
+	if !errors.Is(err, failing) {
+		t.Errorf("parseLines: got error %v, want parser one", err)
+	}
+}
+
+func TestClassifyErr(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   error
+	}{
+		{"no server running on /tmp/tmux-1000/default\n", ErrServerNotRunning{Message: "no server running on /tmp/tmux-1000/default"}},
+		{"can't find session: foo\n", ErrSessionNotFound{Name: "foo"}},
+		{"can't find pane: %99\n", ErrTargetNotFound{Target: "foo"}},
+	}
+	for _, tt := range tests {
+		got := classifyErr(&exec.ExitError{Stderr: []byte(tt.stderr)}, "foo")
+		if got != tt.want {
+			t.Errorf("classifyErr(%q) = %#v, want %#v", tt.stderr, got, tt.want)
+		}
+	}
+	got := classifyErr(&exec.ExitError{Stderr: []byte("unknown command: foo\n")}, "foo")
+	if got == nil || got.Error() != "tmux: unknown command: foo" {
+		t.Errorf("classifyErr(unknown command) = %v", got)
+	}
+	plain := errors.New("plain")
+	if got := classifyErr(plain, "foo"); got != plain {
+		t.Errorf("classifyErr(plain) = %v, want it intact", got)
+	}
+}
+
+func TestCurrentSessionOutsideTmux(t *testing.T) {
+	t.Setenv("TMUX", "")
+	name, err := CurrentSession()
+	if name != "" || err != nil {
+		t.Errorf("CurrentSession() = %q, %v, want no session", name, err)
+	}
+}
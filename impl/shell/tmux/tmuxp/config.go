@@ -0,0 +1,338 @@
+package tmuxp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/wiedzmin/toolbox/impl/fs"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
+	"github.com/wiedzmin/toolbox/impl/shell/tmux"
+	"gopkg.in/yaml.v3"
+)
+
+// NOTE: tmuxp treats these as empty panes, along with null ones
+var blankPanes = []string{"blank", "pane"}
+
+var yamlErrLineRegexp = regexp.MustCompile(`line (\d+): (.*)`)
+
+type ErrInvalidConfig struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (e ErrInvalidConfig) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("tmuxp: %s:%d: %s", e.Path, e.Line, e.Message)
+	}
+	return fmt.Sprintf("tmuxp: %s: %s", e.Path, e.Message)
+}
+
+// Config is a tmuxp session configuration, only the subset of schema, which is used around, is modelled
+// Line fields refer to respective places in the file, if it was read from one
+type Config struct {
+	SessionName    string         `yaml:"session_name"`
+	StartDirectory string         `yaml:"start_directory,omitempty"`
+	BeforeScript   string         `yaml:"before_script,omitempty"`
+	Windows        []WindowConfig `yaml:"windows"`
+
+	Path     string         `yaml:"-"`
+	keyLines map[string]int `yaml:"-"`
+}
+
+type WindowConfig struct {
+	WindowName     string       `yaml:"window_name"`
+	Layout         string       `yaml:"layout,omitempty"`
+	StartDirectory string       `yaml:"start_directory,omitempty"`
+	Focus          bool         `yaml:"focus,omitempty"`
+	Panes          []PaneConfig `yaml:"panes"`
+
+	Line int `yaml:"-"`
+}
+
+type PaneConfig struct {
+	ShellCommand   Commands `yaml:"shell_command,omitempty"`
+	StartDirectory string   `yaml:"start_directory,omitempty"`
+	Focus          bool     `yaml:"focus,omitempty"`
+
+	Line int `yaml:"-"`
+}
+
+// Commands is a list of shell commands, tmuxp also accepts a single one as plain string
+type Commands []string
+
+func (c *Commands) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*c = Commands{node.Value}
+	case yaml.SequenceNode:
+		var result Commands
+		for _, n := range node.Content {
+			if n.Kind != yaml.ScalarNode {
+				return ErrInvalidConfig{Line: n.Line, Message: "shell command should be a string"}
+			}
+			result = append(result, n.Value)
+		}
+		*c = result
+	default:
+		return ErrInvalidConfig{Line: node.Line, Message: "shell_command should be either a string or a list of strings"}
+	}
+	return nil
+}
+
+func (c *Config) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return ErrInvalidConfig{Line: node.Line, Message: "session configuration should be a mapping"}
+	}
+	type plain Config
+	var result plain
+	err := node.Decode(&result)
+	if err != nil {
+		return err
+	}
+	*c = Config(result)
+	c.keyLines = make(map[string]int)
+	for i := 0; i < len(node.Content); i += 2 {
+		c.keyLines[node.Content[i].Value] = node.Content[i].Line
+	}
+	return nil
+}
+
+func (w *WindowConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return ErrInvalidConfig{Line: node.Line, Message: "window should be a mapping"}
+	}
+	// NOTE: distinct type has no UnmarshalYAML method, so that there is no infinite recursion
+	type plain WindowConfig
+	var result plain
+	err := node.Decode(&result)
+	if err != nil {
+		return err
+	}
+	*w = WindowConfig(result)
+	w.Line = node.Line
+	// NOTE: null items are dropped by decoder, while tmuxp treats them as blank panes, so panes are decoded one by one
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != "panes" || node.Content[i+1].Kind != yaml.SequenceNode {
+			continue
+		}
+		w.Panes = nil
+		for _, n := range node.Content[i+1].Content {
+			pane := PaneConfig{Line: n.Line}
+			if n.Tag != "!!null" {
+				err = n.Decode(&pane)
+				if err != nil {
+					return err
+				}
+			}
+			w.Panes = append(w.Panes, pane)
+		}
+	}
+	return nil
+}
+
+func (p *PaneConfig) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*p = PaneConfig{}
+		if !slices.Contains(blankPanes, node.Value) {
+			p.ShellCommand = Commands{node.Value}
+		}
+	case yaml.MappingNode:
+		type plain PaneConfig
+		var result plain
+		err := node.Decode(&result)
+		if err != nil {
+			return err
+		}
+		*p = PaneConfig(result)
+	default:
+		return ErrInvalidConfig{Line: node.Line, Message: "pane should be either a command or a mapping"}
+	}
+	p.Line = node.Line
+	return nil
+}
+
+// SessionPath returns path of configuration file for session name under root
+// NOTE: slashes are valid in tmux session names, yet not in file names
+func SessionPath(root, name string) string {
+	return filepath.Join(root, fmt.Sprintf("%s.%s", strings.ReplaceAll(name, "/", "_"), SESSION_FILE_SUFFIX))
+}
+
+// parseErr turns YAML parser errors into ErrInvalidConfig, extracting line numbers
+func parseErr(path string, err error) error {
+	switch e := err.(type) {
+	case ErrInvalidConfig:
+		e.Path = path
+		return e
+	case *yaml.TypeError:
+		// NOTE: reporting the first problem only, as the rest of them are quite often its consequences
+		if len(e.Errors) > 0 {
+			return parseErrMessage(path, e.Errors[0])
+		}
+	}
+	return parseErrMessage(path, strings.TrimPrefix(err.Error(), "yaml: "))
+}
+
+func parseErrMessage(path, message string) error {
+	result := ErrInvalidConfig{Path: path, Message: message}
+	if m := yamlErrLineRegexp.FindStringSubmatch(message); m != nil {
+		result.Line, _ = strconv.Atoi(m[1])
+		result.Message = m[2]
+	}
+	return result
+}
+
+// ReadConfig parses configuration file, syntax and schema errors are reported as ErrInvalidConfig
+// Semantic problems are not checked, see Validate
+func ReadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var result Config
+	err = yaml.Unmarshal(data, &result)
+	if err != nil {
+		return nil, parseErr(path, err)
+	}
+	result.Path = path
+	return &result, nil
+}
+
+// expandPath resolves path the way tmuxp does, i.e. expanding environment variables and "~",
+// relative paths are resolved against base
+func expandPath(path, base string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		path = fs.AtHomedir(strings.TrimPrefix(strings.TrimPrefix(path, "~"), "/"))
+	}
+	if !filepath.IsAbs(path) && base != "" {
+		path = filepath.Join(base, path)
+	}
+	return path
+}
+
+// Validate checks configuration for problems that tmuxp would either reject or silently misbehave on
+// Missing directories are reported too, as they usually mean that configuration has drifted away from reality
+func (c *Config) Validate() []ErrInvalidConfig {
+	var result []ErrInvalidConfig
+	report := func(line int, format string, args ...interface{}) {
+		result = append(result, ErrInvalidConfig{Path: c.Path, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+	checkDirectory := func(line int, path, base string) {
+		if path == "" {
+			return
+		}
+		if !fs.DirExists(expandPath(path, base)) {
+			report(line, "start_directory '%s' does not exist", path)
+		}
+	}
+	configDir := filepath.Dir(c.Path)
+
+	if c.SessionName == "" {
+		report(0, "session_name is missing")
+	}
+	if c.BeforeScript != "" && !fs.FileExists(expandPath(c.BeforeScript, configDir)) {
+		report(c.keyLines["before_script"], "before_script '%s' does not exist", c.BeforeScript)
+	}
+	checkDirectory(c.keyLines["start_directory"], c.StartDirectory, configDir)
+	sessionDir := expandPath(c.StartDirectory, configDir)
+	if len(c.Windows) == 0 {
+		report(c.keyLines["windows"], "windows are missing")
+	}
+	for i, w := range c.Windows {
+		if w.WindowName == "" {
+			report(w.Line, "window #%d is missing window_name", i+1)
+		}
+		checkDirectory(w.Line, w.StartDirectory, sessionDir)
+		windowDir := expandPath(w.StartDirectory, sessionDir)
+		for _, p := range w.Panes {
+			checkDirectory(p.Line, p.StartDirectory, windowDir)
+		}
+	}
+	return result
+}
+
+// LoadConfig reads configuration file and validates it, returning the first problem found, if any
+func LoadConfig(path string) (*Config, error) {
+	config, err := ReadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if problems := config.Validate(); len(problems) > 0 {
+		return nil, problems[0]
+	}
+	return config, nil
+}
+
+// Write stores configuration to file, replacing existing one
+func (c *Config) Write(path string) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	err := encoder.Encode(c)
+	if err != nil {
+		return err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// Snapshot captures live session's windows, their layouts and panes, along with cwds and foreground commands
+// Commands are captured on a best effort basis, failing to get one just leaves respective pane with shell only
+func Snapshot(session tmux.Session) (*Config, error) {
+	l := logger.Sugar()
+	windows, err := session.ListWindows()
+	if err != nil {
+		return nil, err
+	}
+	panes, err := session.ListPanes()
+	if err != nil {
+		return nil, err
+	}
+	panesByWindow := make(map[string][]tmux.Pane)
+	for _, p := range panes {
+		panesByWindow[p.WindowID] = append(panesByWindow[p.WindowID], p)
+	}
+	result := Config{
+		SessionName:    session.Name,
+		StartDirectory: session.Path,
+	}
+	for _, w := range windows {
+		window := WindowConfig{
+			WindowName: w.Name,
+			Layout:     w.Layout,
+			Focus:      w.Active,
+		}
+		for _, p := range panesByWindow[w.ID] {
+			pane := PaneConfig{
+				StartDirectory: p.Path,
+				Focus:          p.Active,
+			}
+			argv, err := p.ForegroundCommand()
+			if err != nil {
+				l.Warnw("[Snapshot]", "session", session.Name, "pane", p.ID, "err", err)
+			}
+			if len(argv) > 0 {
+				var words []string
+				for _, arg := range argv {
+					words = append(words, proc.QuoteWord(arg))
+				}
+				pane.ShellCommand = Commands{strings.Join(words, " ")}
+			}
+			window.Panes = append(window.Panes, pane)
+		}
+		l.Debugw("[Snapshot]", "session", session.Name, "window", w.Name, "panes", len(window.Panes))
+		result.Windows = append(result.Windows, window)
+	}
+	return &result, nil
+}
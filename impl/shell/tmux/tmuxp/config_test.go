@@ -0,0 +1,168 @@
+package tmuxp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "session.yml")
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadConfig(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `session_name: main
+start_directory: /tmp
+windows:
+  - window_name: editor
+    layout: main-vertical
+    focus: true
+    panes:
+      - nvim
+      - shell_command:
+          - cd src
+          - make watch
+        start_directory: src
+      - blank
+      - null
+  - window_name: logs
+    panes:
+      - shell_command: tail -f log
+`)
+	config, err := ReadConfig(path)
+	if err != nil {
+		t.Fatalf("ReadConfig: unexpected error: %v", err)
+	}
+	want := []WindowConfig{
+		{WindowName: "editor", Layout: "main-vertical", Focus: true, Line: 4, Panes: []PaneConfig{
+			{ShellCommand: Commands{"nvim"}, Line: 8},
+			{ShellCommand: Commands{"cd src", "make watch"}, StartDirectory: "src", Line: 9},
+			{Line: 13},
+			{Line: 14},
+		}},
+		{WindowName: "logs", Line: 15, Panes: []PaneConfig{
+			{ShellCommand: Commands{"tail -f log"}, Line: 17},
+		}},
+	}
+	if config.SessionName != "main" || config.StartDirectory != "/tmp" || config.Path != path {
+		t.Errorf("ReadConfig = %+v", config)
+	}
+	if !reflect.DeepEqual(config.Windows, want) {
+		t.Errorf("ReadConfig windows = %+v, want %+v", config.Windows, want)
+	}
+}
+
+func TestReadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    int
+	}{
+		{"syntax", "session_name: main\nwindows:\n\t- window_name: editor\n", 3},
+		{"not a mapping", "- just\n- a list\n", 1},
+		{"window is not a mapping", "session_name: main\nwindows:\n  - editor\n", 3},
+		{"pane is a list", "session_name: main\nwindows:\n  - window_name: editor\n    panes:\n      - - nvim\n", 5},
+		{"shell command is a mapping", "session_name: main\nwindows:\n  - window_name: editor\n    panes:\n" +
+			"      - shell_command:\n          cmd: nvim\n", 6},
+		{"nested shell command", "session_name: main\nwindows:\n  - window_name: editor\n    panes:\n" +
+			"      - shell_command:\n          - [nvim]\n", 6},
+		{"type mismatch", "session_name: main\nwindows:\n  - window_name: editor\n    focus: sometimes\n", 4},
+	}
+	for _, tt := range tests {
+		path := writeConfig(t, t.TempDir(), tt.content)
+		_, err := ReadConfig(path)
+		var invalid ErrInvalidConfig
+		if !errors.As(err, &invalid) {
+			t.Errorf("%s: got error %v, want ErrInvalidConfig", tt.name, err)
+			continue
+		}
+		if invalid.Path != path || invalid.Line != tt.line {
+			t.Errorf("%s: got error at %s:%d, want %s:%d (%s)", tt.name, invalid.Path, invalid.Line, path, tt.line, invalid.Message)
+		}
+	}
+
+	_, err := ReadConfig(filepath.Join(t.TempDir(), "missing.yml"))
+	if !os.IsNotExist(err) {
+		t.Errorf("ReadConfig(missing): got error %v, want not exist", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, "src"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    []int
+	}{
+		{"valid", "session_name: main\nstart_directory: .\nwindows:\n  - window_name: editor\n" +
+			"    start_directory: src\n    panes:\n      - nvim\n", nil},
+		{"missing session name", "windows:\n  - window_name: editor\n", []int{0}},
+		{"missing windows", "session_name: main\nwindows: []\n", []int{2}},
+		{"missing window name", "session_name: main\nwindows:\n  - panes:\n      - nvim\n", []int{3}},
+		{"missing session directory", "session_name: main\nstart_directory: nowhere\nwindows:\n" +
+			"  - window_name: editor\n", []int{2}},
+		// NOTE: window directories are relative to session one, and pane directories to window one
+		{"missing nested directories", "session_name: main\nstart_directory: src\nwindows:\n" +
+			"  - window_name: editor\n    start_directory: src\n    panes:\n" +
+			"      - start_directory: nowhere\n", []int{4, 7}},
+		{"missing before script", "session_name: main\nbefore_script: ./bootstrap.sh\nwindows:\n" +
+			"  - window_name: editor\n", []int{2}},
+	}
+	for _, tt := range tests {
+		config, err := ReadConfig(writeConfig(t, dir, tt.content))
+		if err != nil {
+			t.Errorf("%s: ReadConfig: unexpected error: %v", tt.name, err)
+			continue
+		}
+		var got []int
+		for _, p := range config.Validate() {
+			got = append(got, p.Line)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Validate reported lines %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteReadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.yml")
+	config := Config{
+		SessionName:    "main",
+		StartDirectory: "/tmp",
+		Windows: []WindowConfig{
+			{WindowName: "editor", Layout: "tiled", Focus: true, Panes: []PaneConfig{
+				{ShellCommand: Commands{"nvim"}, StartDirectory: "/tmp/src"},
+				{},
+			}},
+		},
+	}
+	err := config.Write(path)
+	if err != nil {
+		t.Fatalf("Write: unexpected error: %v", err)
+	}
+	got, err := ReadConfig(path)
+	if err != nil {
+		t.Fatalf("ReadConfig: unexpected error: %v", err)
+	}
+	if got.SessionName != config.SessionName || got.StartDirectory != config.StartDirectory || len(got.Windows) != 1 {
+		t.Fatalf("ReadConfig = %+v, want %+v", got, config)
+	}
+	w := got.Windows[0]
+	if w.WindowName != "editor" || w.Layout != "tiled" || !w.Focus || len(w.Panes) != 2 ||
+		!reflect.DeepEqual(w.Panes[0].ShellCommand, Commands{"nvim"}) || w.Panes[0].StartDirectory != "/tmp/src" ||
+		len(w.Panes[1].ShellCommand) != 0 {
+		t.Errorf("ReadConfig window = %+v, want %+v", w, config.Windows[0])
+	}
+}
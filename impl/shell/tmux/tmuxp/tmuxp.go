@@ -1,16 +1,22 @@
 package tmuxp
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/wiedzmin/toolbox/impl"
 	"github.com/wiedzmin/toolbox/impl/fs"
-	"github.com/wiedzmin/toolbox/impl/shell"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
 	"go.uber.org/zap"
 )
 
-const SESSION_FILE_SUFFIX = "yml"
+const (
+	SESSION_FILE_SUFFIX = "yml"
+
+	sessionFileRegexp = `\.` + SESSION_FILE_SUFFIX + "$"
+)
 
 type Session struct {
 	Name string
@@ -36,44 +42,56 @@ func SessionsRootDefault() string {
 	return fs.AtHomedir(".tmuxp")
 }
 
+// CollectSessions returns sessions configured under root, named after session_name from respective files
+// Files which could not be read are still listed, by their names, so that they could be validated later
 func CollectSessions(root string) ([]Session, error) {
 	l := logger.Sugar()
-	sessionFiles := fs.NewFSCollection(root, []string{SESSION_FILE_SUFFIX}, nil, false).Emit(false)
+	sessionFiles := fs.NewFSCollection(root, []string{sessionFileRegexp}, nil, false).Emit(false)
 	var result []Session
 	for _, f := range sessionFiles {
-		l.Debugw("[CollectSessions]", "session", f)
+		path := filepath.Join(root, f)
+		name := strings.TrimSuffix(f, filepath.Ext(f))
+		config, err := ReadConfig(path)
+		if err != nil {
+			l.Warnw("[CollectSessions]", "path", path, "err", err)
+		} else if config.SessionName != "" {
+			name = config.SessionName
+		}
+		l.Debugw("[CollectSessions]", "session", name, "path", path)
 		result = append(result, Session{
-			Name: strings.Split(f, ".")[0],
-			Path: fmt.Sprintf("%s/%s", root, f),
+			Name: name,
+			Path: path,
 		})
 	}
 	return result, nil
 }
 
+// GetSession looks up session by its name, falling back to file name
 func GetSession(root, name string) (*Session, error) {
 	l := logger.Sugar()
-	regexp := name
-	if !strings.HasSuffix(name, SESSION_FILE_SUFFIX) {
-		regexp = fmt.Sprintf("%s/%s", name, SESSION_FILE_SUFFIX)
+	l.Debugw("[GetSession]", "root", root, "name", name)
+	sessions, err := CollectSessions(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		if s.Name == name {
+			return &s, nil
+		}
 	}
-	l.Debugw("[GetSession]", "root", root, "name", name, "regexp", regexp)
-	sessionFiles := fs.NewFSCollection(root, []string{regexp}, nil, false).Emit(false)
-	if len(sessionFiles) == 0 {
-		return nil, ErrSessionNotFound{Name: name}
+	path := SessionPath(root, name)
+	if fs.FileExists(path) {
+		return &Session{Name: name, Path: path}, nil
 	}
-	return &Session{
-		Name: name,
-		Path: fmt.Sprintf("%s/%s", root, sessionFiles[0]),
-	}, nil
+	return nil, ErrSessionNotFound{Name: name}
 }
 
 func (s *Session) Load(attach bool) error {
 	l := logger.Sugar()
-	cmd := fmt.Sprintf("tmuxp load -y -d %s", s.Path)
+	argv := []string{"tmuxp", "load", "-y", "-d", s.Path}
 	if attach {
-		cmd = fmt.Sprintf("tmuxp load -y %s", s.Path)
+		argv = []string{"tmuxp", "load", "-y", s.Path}
 	}
-	l.Debugw(fmt.Sprintf("[%s.GetSession]", s.Name), "cmd", cmd)
-	_, err := shell.ShellCmd(cmd, nil, nil, nil, false, false)
-	return err
+	l.Debugw(fmt.Sprintf("[%s.Load]", s.Name), "argv", argv)
+	return proc.Run(context.Background(), argv, proc.Options{})
 }
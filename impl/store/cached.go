@@ -0,0 +1,226 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+type ErrStoreUnavailable struct {
+	Backend string
+	Cause   error
+}
+
+func (e ErrStoreUnavailable) Error() string {
+	return fmt.Sprintf("metadata store '%s' is unavailable: %v", e.Backend, e.Cause)
+}
+
+func (e ErrStoreUnavailable) Unwrap() error {
+	return e.Cause
+}
+
+// IsUnavailable checks if error means that store could not be reached, rather than failed request
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var unavailable ErrStoreUnavailable
+	if errors.As(err, &unavailable) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// Cached wraps remote store, keeping last-known-good copies of read values in local files store
+// If backend is unreachable and fallback is allowed, reads are served from those copies, while writes fail
+type Cached struct {
+	backend     Store
+	backendName string
+	cause       error
+	cache       *Files
+	fallback    bool
+}
+
+// NewCached wraps backend with local cache, rooted at provided directory
+// backend could be nil, which means that it was not reachable in the first place, with cause explaining why
+func NewCached(backend Store, backendName string, cause error, cacheRoot string, fallback bool) *Cached {
+	return &Cached{
+		backend:     backend,
+		backendName: backendName,
+		cause:       cause,
+		cache:       NewFiles(cacheRoot),
+		fallback:    fallback,
+	}
+}
+
+// Degraded reports if store is being served from local cache only
+func (c *Cached) Degraded() bool {
+	return c.backend == nil
+}
+
+func (c *Cached) unavailable(err error) error {
+	if err == nil {
+		err = c.cause
+	}
+	return ErrStoreUnavailable{Backend: c.backendName, Cause: err}
+}
+
+// degrade decides if request failure should be answered from cache
+func (c *Cached) degrade(err error) bool {
+	l := logger.Sugar()
+	if c.backend != nil && !IsUnavailable(err) {
+		return false
+	}
+	if c.fallback {
+		l.Warnw("[Cached]", "backend", c.backendName, "err", err, "summary", "serving from local cache")
+	}
+	return c.fallback
+}
+
+func (c *Cached) remember(key string, value []byte) {
+	l := logger.Sugar()
+	if value == nil {
+		return
+	}
+	err := c.cache.SetValue(key, string(value))
+	if err != nil {
+		l.Warnw("[Cached.remember]", "key", key, "err", err)
+	}
+}
+
+func (c *Cached) forget(key string) {
+	l := logger.Sugar()
+	err := c.cache.DeleteValue(key)
+	if err != nil {
+		l.Warnw("[Cached.forget]", "key", key, "err", err)
+	}
+}
+
+func (c *Cached) GetValue(key string) ([]byte, error) {
+	var err error
+	if c.backend != nil {
+		var value []byte
+		value, err = c.backend.GetValue(key)
+		if err == nil {
+			c.remember(key, value)
+			return value, nil
+		}
+	}
+	if c.degrade(err) {
+		return c.cache.GetValue(key)
+	}
+	if c.backend != nil && !IsUnavailable(err) {
+		return nil, err
+	}
+	return nil, c.unavailable(err)
+}
+
+func (c *Cached) GetValuesMapFuzzy(pattern string) (map[string][]byte, error) {
+	var err error
+	if c.backend != nil {
+		var values map[string][]byte
+		values, err = c.backend.GetValuesMapFuzzy(pattern)
+		if err == nil {
+			for key, value := range values {
+				c.remember(key, value)
+			}
+			return values, nil
+		}
+	}
+	if c.degrade(err) {
+		return c.cache.GetValuesMapFuzzy(pattern)
+	}
+	if c.backend != nil && !IsUnavailable(err) {
+		return nil, err
+	}
+	return nil, c.unavailable(err)
+}
+
+func (c *Cached) SetValue(key, value string) error {
+	if c.backend == nil {
+		return c.unavailable(nil)
+	}
+	err := c.backend.SetValue(key, value)
+	if err != nil {
+		if IsUnavailable(err) {
+			return c.unavailable(err)
+		}
+		return err
+	}
+	c.remember(key, []byte(value))
+	return nil
+}
+
+func (c *Cached) DeleteValue(key string) error {
+	if c.backend == nil {
+		return c.unavailable(nil)
+	}
+	err := c.backend.DeleteValue(key)
+	if err != nil {
+		if IsUnavailable(err) {
+			return c.unavailable(err)
+		}
+		return err
+	}
+	c.forget(key)
+	return nil
+}
+
+func (c *Cached) KeyExists(key string) bool {
+	if c.backend != nil {
+		return c.backend.KeyExists(key)
+	}
+	return c.fallback && c.cache.KeyExists(key)
+}
+
+func (c *Cached) AppendToList(key string, value string) error {
+	if c.backend == nil {
+		return c.unavailable(nil)
+	}
+	err := c.backend.AppendToList(key, value)
+	if err != nil {
+		if IsUnavailable(err) {
+			return c.unavailable(err)
+		}
+		return err
+	}
+	// NOTE: cached copy is going to be refreshed on next full read
+	c.forget(key)
+	return nil
+}
+
+func (c *Cached) GetList(key string, offset, limit int) ([]string, error) {
+	l := logger.Sugar()
+	var err error
+	if c.backend != nil {
+		var list []string
+		list, err = c.backend.GetList(key, offset, limit)
+		if err == nil {
+			if offset == 0 && limit == -1 {
+				data, err := jsoniter.Marshal(list)
+				if err != nil {
+					l.Warnw("[Cached.GetList]", "key", key, "err", err)
+				} else {
+					c.remember(key, data)
+				}
+			}
+			return list, nil
+		}
+	}
+	if c.degrade(err) {
+		return c.cache.GetList(key, offset, limit)
+	}
+	if c.backend != nil && !IsUnavailable(err) {
+		return nil, err
+	}
+	return nil, c.unavailable(err)
+}
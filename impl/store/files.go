@@ -0,0 +1,225 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/wiedzmin/toolbox/impl"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+	formatYML  = "yml"
+	formatTOML = "toml"
+)
+
+// NOTE: lookup order matters, JSON goes first, because it is what SetValue writes
+var fileFormats = []string{formatJSON, formatYAML, formatYML, formatTOML}
+
+type ErrInvalidKey struct {
+	Key string
+}
+
+func (e ErrInvalidKey) Error() string {
+	return fmt.Sprintf("key '%s' points outside of store", e.Key)
+}
+
+// Files is a directory-backed store, where each key maps to "<root>/<key>.<format>" file
+// YAML and TOML contents are converted to JSON on read, so that consumers need not care about source format
+type Files struct {
+	root  string
+	mutex sync.Mutex
+}
+
+// NewFiles creates store rooted at provided directory
+func NewFiles(root string) *Files {
+	return &Files{root: root}
+}
+
+// pathFor maps key to file path, keys escaping root, e.g. "../foo", are rejected
+func (f *Files) pathFor(key, format string) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(key))
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidKey{Key: key}
+	}
+	return filepath.Join(f.root, rel) + "." + format, nil
+}
+
+func (f *Files) lookup(key string) (string, string, bool, error) {
+	for _, format := range fileFormats {
+		p, err := f.pathFor(key, format)
+		if err != nil {
+			return "", "", false, err
+		}
+		if _, err := os.Stat(p); err == nil {
+			return p, format, true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+func (f *Files) read(key string) ([]byte, error) {
+	l := logger.Sugar()
+	p, format, found, err := f.lookup(key)
+	if err != nil || !found {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	l.Debugw("[Files.read]", "key", key, "path", p, "format", format)
+	switch format {
+	case formatYAML, formatYML:
+		var parsed interface{}
+		err = yaml.Unmarshal(data, &parsed)
+		if err != nil {
+			return nil, impl.FileFormatError{Content: fmt.Sprintf("%s: %s", p, err.Error())}
+		}
+		return jsoniter.Marshal(parsed)
+	case formatTOML:
+		var parsed map[string]interface{}
+		_, err = toml.Decode(string(data), &parsed)
+		if err != nil {
+			return nil, impl.FileFormatError{Content: fmt.Sprintf("%s: %s", p, err.Error())}
+		}
+		return jsoniter.Marshal(parsed)
+	default:
+		return data, nil
+	}
+}
+
+func (f *Files) write(key string, data []byte) error {
+	p, err := f.pathFor(key, formatJSON)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+func (f *Files) readList(key string) ([]string, error) {
+	data, err := f.read(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var result []string
+	err = jsoniter.Unmarshal(data, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (f *Files) GetValue(key string) ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.read(key)
+}
+
+func (f *Files) GetValuesMapFuzzy(pattern string) (map[string][]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	l := logger.Sugar()
+	result := make(map[string][]byte)
+	err := filepath.WalkDir(f.root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(f.root, p)
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(rel)
+		key := filepath.ToSlash(strings.TrimSuffix(rel, ext))
+		matched, err := path.Match(pattern, key)
+		if err != nil || !matched {
+			return err
+		}
+		if _, ok := result[key]; ok {
+			return nil
+		}
+		value, err := f.read(key)
+		if err != nil {
+			return err
+		}
+		l.Debugw("[Files.GetValuesMapFuzzy]", "key", key)
+		result[key] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (f *Files) SetValue(key, value string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.write(key, []byte(value))
+}
+
+func (f *Files) DeleteValue(key string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, format := range fileFormats {
+		p, err := f.pathFor(key, format)
+		if err != nil {
+			return err
+		}
+		err = os.Remove(p)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Files) KeyExists(key string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	_, _, found, _ := f.lookup(key)
+	return found
+}
+
+func (f *Files) AppendToList(key string, value string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	list, err := f.readList(key)
+	if err != nil {
+		return err
+	}
+	data, err := jsoniter.Marshal(append(list, value))
+	if err != nil {
+		return err
+	}
+	return f.write(key, data)
+}
+
+func (f *Files) GetList(key string, offset, limit int) ([]string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	list, err := f.readList(key)
+	if err != nil {
+		return nil, err
+	}
+	return listRange(list, offset, limit), nil
+}
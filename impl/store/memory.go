@@ -0,0 +1,85 @@
+package store
+
+import (
+	"path"
+	"sync"
+)
+
+// Memory is an in-process store, useful for tests and one-shot runs
+type Memory struct {
+	mutex  sync.Mutex
+	values map[string][]byte
+	lists  map[string][]string
+}
+
+// NewMemory creates in-memory store, optionally seeded with provided values
+func NewMemory(seed map[string][]byte) *Memory {
+	result := Memory{
+		values: make(map[string][]byte),
+		lists:  make(map[string][]string),
+	}
+	for key, value := range seed {
+		result.values[key] = value
+	}
+	return &result
+}
+
+func (m *Memory) GetValue(key string) ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	// NOTE: missing key is not an error, same as for Redis GET
+	return m.values[key], nil
+}
+
+func (m *Memory) GetValuesMapFuzzy(pattern string) (map[string][]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	result := make(map[string][]byte)
+	for key, value := range m.values {
+		matched, err := path.Match(pattern, key)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			result[key] = value
+		}
+	}
+	return result, nil
+}
+
+func (m *Memory) SetValue(key, value string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.lists, key)
+	m.values[key] = []byte(value)
+	return nil
+}
+
+func (m *Memory) DeleteValue(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.values, key)
+	delete(m.lists, key)
+	return nil
+}
+
+func (m *Memory) KeyExists(key string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, isValue := m.values[key]
+	_, isList := m.lists[key]
+	return isValue || isList
+}
+
+func (m *Memory) AppendToList(key string, value string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lists[key] = append(m.lists[key], value)
+	return nil
+}
+
+func (m *Memory) GetList(key string, offset, limit int) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return listRange(m.lists[key], offset, limit), nil
+}
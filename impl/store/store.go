@@ -0,0 +1,220 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+	"github.com/wiedzmin/toolbox/impl"
+	"github.com/wiedzmin/toolbox/impl/fs"
+	"github.com/wiedzmin/toolbox/impl/redis"
+	"go.uber.org/zap"
+)
+
+const (
+	BackendRedis  = "redis"
+	BackendFiles  = "files"
+	BackendMemory = "memory"
+
+	BackendFlagName = "store"
+	BackendDefault  = BackendRedis
+	PathFlagName    = "store-path"
+)
+
+var (
+	logger *zap.Logger
+
+	BackendEnvVarName = fmt.Sprintf("%s_STORE", impl.EnvPrefix)
+	PathEnvVarName    = fmt.Sprintf("%s_STORE_PATH", impl.EnvPrefix)
+
+	sharedOptions = Options{Backend: BackendDefault, Path: PathDefault(), CachePath: CachePathDefault()}
+	sharedStore   Store
+	sharedMutex   sync.Mutex
+)
+
+func init() {
+	logger = impl.NewLogger()
+}
+
+// Store is a key-value metadata storage, modelled after the subset of Redis commands being used throughout toolbox
+// Values are raw bytes, so that existing `New*(data []byte)` parsers could be fed with them directly
+type Store interface {
+	GetValue(key string) ([]byte, error)
+	GetValuesMapFuzzy(pattern string) (map[string][]byte, error)
+	SetValue(key, value string) error
+	DeleteValue(key string) error
+	KeyExists(key string) bool
+	AppendToList(key string, value string) error
+	GetList(key string, offset, limit int) ([]string, error)
+}
+
+// Options selects store backend, Path is only meaningful for files backend
+// ReadOnly allows serving reads from last-known-good local cache, when backend is unavailable
+type Options struct {
+	Backend   string
+	Path      string
+	CachePath string
+	ReadOnly  bool
+	Redis     redis.Options
+}
+
+type ErrUnknownBackend struct {
+	Name string
+}
+
+func (e ErrUnknownBackend) Error() string {
+	return fmt.Sprintf("unknown store backend: '%s'", e.Name)
+}
+
+// PathDefault returns default root for files store backend
+func PathDefault() string {
+	return fs.AtDotConfig("toolbox/store")
+}
+
+// CachePathDefault returns default root for last-known-good copies of remote store values
+func CachePathDefault() string {
+	return fs.AtDotCache("toolbox/store")
+}
+
+// New instantiates store according to provided options
+func New(opts Options) (Store, error) {
+	l := logger.Sugar()
+	l.Debugw("[New]", "backend", opts.Backend, "path", opts.Path)
+	switch opts.Backend {
+	case BackendRedis:
+		client, err := redis.NewClient(opts.Redis)
+		if err != nil {
+			return nil, ErrStoreUnavailable{Backend: BackendRedis, Cause: err}
+		}
+		return client, nil
+	case BackendFiles:
+		return NewFiles(opts.Path), nil
+	case BackendMemory:
+		return NewMemory(nil), nil
+	default:
+		return nil, ErrUnknownBackend{Name: opts.Backend}
+	}
+}
+
+// CLIFlags returns flags for selecting store backend, to be appended to command's own ones
+func CLIFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     BackendFlagName,
+			EnvVars:  []string{BackendEnvVarName},
+			Value:    BackendDefault,
+			Usage:    "Metadata store backend to use, e.g. redis, files, memory",
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     PathFlagName,
+			EnvVars:  []string{PathEnvVarName},
+			Value:    PathDefault(),
+			Usage:    "Root directory for files store backend",
+			Required: false,
+		},
+	}, redis.CLIFlags()...)
+}
+
+// OptionsFromContext returns store options from CLI flags
+func OptionsFromContext(ctx *cli.Context) Options {
+	result := Options{
+		Backend:   ctx.String(BackendFlagName),
+		Path:      ctx.String(PathFlagName),
+		CachePath: CachePathDefault(),
+		Redis:     redis.OptionsFromContext(ctx),
+	}
+	if result.Backend == "" {
+		result.Backend = BackendDefault
+	}
+	if result.Path == "" {
+		result.Path = PathDefault()
+	}
+	return result
+}
+
+// Configure sets options for shared store, dropping already instantiated one, if any
+func Configure(opts Options) {
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+	sharedStore = nil
+	sharedOptions = opts
+	redis.Configure(opts.Redis)
+}
+
+// ConfigureFromContext configures shared store from CLI flags, suitable for usage as `cli.App.Before`
+func ConfigureFromContext(ctx *cli.Context) error {
+	Configure(OptionsFromContext(ctx))
+	return nil
+}
+
+// ConfigureReadOnlyFromContext is the same as ConfigureFromContext, but for commands which do not write to store,
+// hence could tolerate store unavailability by reading last-known-good values from local cache
+func ConfigureReadOnlyFromContext(ctx *cli.Context) error {
+	opts := OptionsFromContext(ctx)
+	opts.ReadOnly = true
+	Configure(opts)
+	return nil
+}
+
+// Use makes provided store the shared one, mostly for testing purposes
+func Use(s Store) {
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+	sharedStore = s
+}
+
+// Shared returns store, shared between all packages, instantiating it on first use
+// Remote backends are wrapped with local cache, see Cached for details
+// ErrStoreUnavailable is returned if backend could not be reached and degraded mode is not allowed
+func Shared() (Store, error) {
+	l := logger.Sugar()
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+	if sharedStore != nil {
+		return sharedStore, nil
+	}
+	if sharedOptions.Backend != BackendRedis {
+		s, err := New(sharedOptions)
+		if err != nil {
+			return nil, err
+		}
+		sharedStore = s
+		return sharedStore, nil
+	}
+	// NOTE: reuse redis-level shared client, so that there is only one pool per process
+	client, err := redis.Shared()
+	if err != nil {
+		l.Warnw("[Shared]", "backend", sharedOptions.Backend, "readOnly", sharedOptions.ReadOnly, "err", err)
+		if !sharedOptions.ReadOnly {
+			return nil, ErrStoreUnavailable{Backend: sharedOptions.Backend, Cause: err}
+		}
+		sharedStore = NewCached(nil, sharedOptions.Backend, err, sharedOptions.CachePath, true)
+		return sharedStore, nil
+	}
+	sharedStore = NewCached(client, sharedOptions.Backend, nil, sharedOptions.CachePath, sharedOptions.ReadOnly)
+	return sharedStore, nil
+}
+
+// listRange mimics LRANGE semantics, i.e. both indices are inclusive and negative ones count from the end
+func listRange(list []string, start, stop int) []string {
+	length := len(list)
+	if start < 0 {
+		start = length + start
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return []string{}
+	}
+	result := make([]string, stop-start+1)
+	copy(result, list[start:stop+1])
+	return result
+}
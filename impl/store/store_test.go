@@ -0,0 +1,231 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func backends(t *testing.T) map[string]Store {
+	return map[string]Store{
+		BackendMemory: NewMemory(nil),
+		BackendFiles:  NewFiles(t.TempDir()),
+	}
+}
+
+func TestStoreValues(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			value, err := s.GetValue("missing")
+			if err != nil || value != nil {
+				t.Errorf("GetValue(missing) = %q, %v, want nil, nil", value, err)
+			}
+			if s.KeyExists("missing") {
+				t.Errorf("KeyExists(missing) = true")
+			}
+			err = s.DeleteValue("missing")
+			if err != nil {
+				t.Errorf("DeleteValue(missing): unexpected error: %v", err)
+			}
+
+			for _, key := range []string{"plain", "nested/key"} {
+				err = s.SetValue(key, `{"a":1}`)
+				if err != nil {
+					t.Fatalf("SetValue(%s): unexpected error: %v", key, err)
+				}
+				value, err = s.GetValue(key)
+				if err != nil || string(value) != `{"a":1}` {
+					t.Errorf("GetValue(%s) = %q, %v, want %q", key, value, err, `{"a":1}`)
+				}
+				if !s.KeyExists(key) {
+					t.Errorf("KeyExists(%s) = false", key)
+				}
+			}
+
+			err = s.SetValue("plain", `{"a":2}`)
+			if err != nil {
+				t.Fatalf("SetValue(plain): unexpected error: %v", err)
+			}
+			value, _ = s.GetValue("plain")
+			if string(value) != `{"a":2}` {
+				t.Errorf("GetValue(plain) after overwrite = %q", value)
+			}
+
+			err = s.DeleteValue("plain")
+			if err != nil {
+				t.Fatalf("DeleteValue(plain): unexpected error: %v", err)
+			}
+			if s.KeyExists("plain") {
+				t.Errorf("KeyExists(plain) after delete = true")
+			}
+		})
+	}
+}
+
+func TestStoreValuesFuzzy(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"vpn/a", "vpn/b", "vpnx", "other/a"} {
+				err := s.SetValue(key, `"`+key+`"`)
+				if err != nil {
+					t.Fatalf("SetValue(%s): unexpected error: %v", key, err)
+				}
+			}
+			got, err := s.GetValuesMapFuzzy("vpn/*")
+			if err != nil {
+				t.Fatalf("GetValuesMapFuzzy: unexpected error: %v", err)
+			}
+			var keys []string
+			for key, value := range got {
+				keys = append(keys, key)
+				if string(value) != `"`+key+`"` {
+					t.Errorf("GetValuesMapFuzzy: %s = %q", key, value)
+				}
+			}
+			slices.Sort(keys)
+			if want := []string{"vpn/a", "vpn/b"}; !slices.Equal(keys, want) {
+				t.Errorf("GetValuesMapFuzzy(vpn/*) keys = %q, want %q", keys, want)
+			}
+		})
+	}
+}
+
+func TestStoreLists(t *testing.T) {
+	tests := []struct {
+		offset int
+		limit  int
+		want   []string
+	}{
+		{0, -1, []string{"a", "b", "c", "d"}},
+		{0, 1, []string{"a", "b"}},
+		{1, 2, []string{"b", "c"}},
+		{-2, -1, []string{"c", "d"}},
+		{2, 100, []string{"c", "d"}},
+		{-100, 0, []string{"a"}},
+		{3, 1, []string{}},
+		{10, 20, []string{}},
+	}
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			got, err := s.GetList("missing", 0, -1)
+			if err != nil || len(got) != 0 {
+				t.Errorf("GetList(missing) = %q, %v, want empty", got, err)
+			}
+			for _, value := range []string{"a", "b", "c", "d"} {
+				err := s.AppendToList("list", value)
+				if err != nil {
+					t.Fatalf("AppendToList(%s): unexpected error: %v", value, err)
+				}
+			}
+			if !s.KeyExists("list") {
+				t.Errorf("KeyExists(list) = false")
+			}
+			for _, tt := range tests {
+				got, err := s.GetList("list", tt.offset, tt.limit)
+				if err != nil {
+					t.Errorf("GetList(%d, %d): unexpected error: %v", tt.offset, tt.limit, err)
+					continue
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("GetList(%d, %d) = %q, want %q", tt.offset, tt.limit, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFilesFormats(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"from-yaml.yaml": "name: foo\nitems:\n  - 1\n  - two\nnested:\n  1: one\n",
+		"from-yml.yml":   "name: bar\n",
+		"from-toml.toml": "name = \"baz\"\n",
+		// NOTE: JSON takes precedence over other formats for the same key
+		"both.json": `{"name":"json"}`,
+		"both.yaml": "name: yaml\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		key  string
+		want map[string]interface{}
+	}{
+		{"from-yaml", map[string]interface{}{
+			"name":   "foo",
+			"items":  []interface{}{float64(1), "two"},
+			"nested": map[string]interface{}{"1": "one"},
+		}},
+		{"from-yml", map[string]interface{}{"name": "bar"}},
+		{"from-toml", map[string]interface{}{"name": "baz"}},
+		{"both", map[string]interface{}{"name": "json"}},
+	}
+	s := NewFiles(root)
+	for _, tt := range tests {
+		data, err := s.GetValue(tt.key)
+		if err != nil {
+			t.Errorf("GetValue(%s): unexpected error: %v", tt.key, err)
+			continue
+		}
+		var got map[string]interface{}
+		err = jsoniter.Unmarshal(data, &got)
+		if err != nil {
+			t.Errorf("GetValue(%s) = %q, which is not a JSON object: %v", tt.key, data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetValue(%s) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+
+	err := s.DeleteValue("both")
+	if err != nil {
+		t.Fatalf("DeleteValue(both): unexpected error: %v", err)
+	}
+	if s.KeyExists("both") {
+		t.Errorf("KeyExists(both) = true, all formats should have been deleted")
+	}
+}
+
+func TestFilesInvalidKeys(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "store")
+	s := NewFiles(root)
+	for _, key := range []string{"", ".", "..", "../escaped", "a/../../escaped", "a/../.."} {
+		err := s.SetValue(key, "{}")
+		var invalid ErrInvalidKey
+		if !errors.As(err, &invalid) {
+			t.Errorf("SetValue(%q): got error %v, want ErrInvalidKey", key, err)
+		}
+		_, err = s.GetValue(key)
+		if !errors.As(err, &invalid) {
+			t.Errorf("GetValue(%q): got error %v, want ErrInvalidKey", key, err)
+		}
+		err = s.DeleteValue(key)
+		if !errors.As(err, &invalid) {
+			t.Errorf("DeleteValue(%q): got error %v, want ErrInvalidKey", key, err)
+		}
+		if s.KeyExists(key) {
+			t.Errorf("KeyExists(%q) = true", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "escaped.json")); !os.IsNotExist(err) {
+		t.Errorf("value has been written outside of store root")
+	}
+
+	// NOTE: dots, which stay within root, are fine
+	err := s.SetValue("a/../b", "{}")
+	if err != nil {
+		t.Errorf("SetValue(a/../b): unexpected error: %v", err)
+	}
+	if !s.KeyExists("b") {
+		t.Errorf("KeyExists(b) = false")
+	}
+}
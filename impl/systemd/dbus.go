@@ -0,0 +1,346 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	// NOTE: the same mode systemctl uses by default
+	jobModeReplace = "replace"
+
+	jobResultDone = "done"
+
+	dbusErrNoSuchUnit                       = "org.freedesktop.systemd1.NoSuchUnit"
+	dbusErrFileNotFound                     = "org.freedesktop.DBus.Error.FileNotFound"
+	dbusErrAccessDenied                     = "org.freedesktop.DBus.Error.AccessDenied"
+	dbusErrInteractiveAuthorizationRequired = "org.freedesktop.DBus.Error.InteractiveAuthorizationRequired"
+
+	ActiveStateActive       = "active"
+	ActiveStateReloading    = "reloading"
+	ActiveStateInactive     = "inactive"
+	ActiveStateFailed       = "failed"
+	ActiveStateActivating   = "activating"
+	ActiveStateDeactivating = "deactivating"
+)
+
+var (
+	connections      = make(map[bool]*sddbus.Conn)
+	connectionsMutex sync.Mutex
+)
+
+type ErrNoSuchUnit struct {
+	Name string
+}
+
+func (e ErrNoSuchUnit) Error() string {
+	return fmt.Sprintf("no such unit: '%s'", e.Name)
+}
+
+// ErrAccessDenied means that operation needs authorization, which could not be obtained over D-Bus non-interactively
+type ErrAccessDenied struct {
+	Name    string
+	Message string
+}
+
+func (e ErrAccessDenied) Error() string {
+	return fmt.Sprintf("access denied for '%s': %s", e.Name, e.Message)
+}
+
+type ErrJobFailed struct {
+	Name      string
+	Operation string
+	Result    string
+}
+
+func (e ErrJobFailed) Error() string {
+	return fmt.Sprintf("%s of '%s' finished with result '%s'", e.Operation, e.Name, e.Result)
+}
+
+type ErrBusUnavailable struct {
+	User  bool
+	Cause error
+}
+
+func (e ErrBusUnavailable) Error() string {
+	bus := "system"
+	if e.User {
+		bus = "user"
+	}
+	return fmt.Sprintf("systemd is unavailable over %s bus: %v", bus, e.Cause)
+}
+
+func (e ErrBusUnavailable) Unwrap() error {
+	return e.Cause
+}
+
+type ErrUnknownState struct {
+	Name  string
+	State string
+}
+
+func (e ErrUnknownState) Error() string {
+	return fmt.Sprintf("unknown state of '%s': '%s'", e.Name, e.State)
+}
+
+// UnitState is a snapshot of loaded unit's states, as reported by `systemctl list-units`
+type UnitState struct {
+	Unit
+	Description string
+	LoadState   string
+	ActiveState string
+	SubState    string
+}
+
+// connection returns connection to either system or user manager, connecting on first use
+func connection(user bool) (*sddbus.Conn, error) {
+	connectionsMutex.Lock()
+	defer connectionsMutex.Unlock()
+	if conn, ok := connections[user]; ok && conn.Connected() {
+		return conn, nil
+	}
+	var conn *sddbus.Conn
+	var err error
+	if user {
+		conn, err = sddbus.NewUserConnectionContext(context.Background())
+	} else {
+		conn, err = sddbus.NewSystemConnectionContext(context.Background())
+	}
+	if err != nil {
+		return nil, ErrBusUnavailable{User: user, Cause: err}
+	}
+	// NOTE: manager emits job signals reliably to subscribed clients only, and those are needed for waiting on jobs
+	err = conn.Subscribe()
+	if err != nil {
+		conn.Close()
+		return nil, ErrBusUnavailable{User: user, Cause: err}
+	}
+	connections[user] = conn
+	return conn, nil
+}
+
+// classifyErr turns D-Bus errors into typed ones, where possible
+func classifyErr(err error, name string) error {
+	// NOTE: godbus returns both values and pointers, depending on where error originates
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) {
+		var dbusErrPtr *dbus.Error
+		if !errors.As(err, &dbusErrPtr) {
+			return err
+		}
+		dbusErr = *dbusErrPtr
+	}
+	var message string
+	if len(dbusErr.Body) > 0 {
+		message, _ = dbusErr.Body[0].(string)
+	}
+	switch dbusErr.Name {
+	case dbusErrNoSuchUnit, dbusErrFileNotFound:
+		return ErrNoSuchUnit{Name: name}
+	case dbusErrAccessDenied, dbusErrInteractiveAuthorizationRequired:
+		return ErrAccessDenied{Name: name, Message: message}
+	}
+	return err
+}
+
+type jobFunc func(ctx context.Context, name, mode string, ch chan<- string) (int, error)
+
+// runJob enqueues job and waits for it to finish, just like systemctl does
+// Cancelling ctx stops waiting, yet does not cancel job itself
+func (s *Unit) runJob(ctx context.Context, operation string, job func(conn *sddbus.Conn) jobFunc) error {
+	l := logger.Sugar()
+	conn, err := connection(s.User)
+	if err != nil {
+		return err
+	}
+	done := make(chan string, 1)
+	_, err = job(conn)(ctx, s.Name, jobModeReplace, done)
+	if err != nil {
+		return classifyErr(err, s.Name)
+	}
+	var result string
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		return ErrWaitTimeout{Name: s.Name, Operation: operation}
+	}
+	l.Debugw(fmt.Sprintf("[%s.%s]", s.Name, operation), "result", result)
+	if result != jobResultDone {
+		return ErrJobFailed{Name: s.Name, Operation: operation, Result: result}
+	}
+	return nil
+}
+
+// withFallback falls back to spawning systemctl if D-Bus call requires interactive authorization,
+// so that polkit agent could ask user for credentials
+func (s *Unit) withFallback(ctx context.Context, fn func(context.Context) error, cmd string, args ...string) error {
+	l := logger.Sugar()
+	err := fn(ctx)
+	if _, ok := err.(ErrAccessDenied); ok {
+		l.Debugw(fmt.Sprintf("[%s.withFallback]", s.Name), "cmd", cmd, "err", err)
+		return runSysctl(ctx, s.User, cmd, s.Name, args...)
+	}
+	return err
+}
+
+func (s *Unit) start(ctx context.Context) error {
+	return s.runJob(ctx, "start", func(conn *sddbus.Conn) jobFunc { return conn.StartUnitContext })
+}
+
+func (s *Unit) stop(ctx context.Context) error {
+	return s.runJob(ctx, "stop", func(conn *sddbus.Conn) jobFunc { return conn.StopUnitContext })
+}
+
+func (s *Unit) restart(ctx context.Context) error {
+	return s.runJob(ctx, "restart", func(conn *sddbus.Conn) jobFunc { return conn.RestartUnitContext })
+}
+
+func (s *Unit) tryRestart(ctx context.Context) error {
+	return s.runJob(ctx, "try-restart", func(conn *sddbus.Conn) jobFunc { return conn.TryRestartUnitContext })
+}
+
+func (s *Unit) kill(ctx context.Context) error {
+	conn, err := connection(s.User)
+	if err != nil {
+		return err
+	}
+	err = conn.KillUnitWithTarget(ctx, s.Name, sddbus.All, int32(syscall.SIGKILL))
+	return classifyErr(err, s.Name)
+}
+
+func (s *Unit) enable(ctx context.Context) error {
+	conn, err := connection(s.User)
+	if err != nil {
+		return err
+	}
+	_, _, err = conn.EnableUnitFilesContext(ctx, []string{s.Name}, false, false)
+	if err != nil {
+		return classifyErr(err, s.Name)
+	}
+	// NOTE: systemctl reloads manager after changing unit files as well
+	return classifyErr(conn.ReloadContext(ctx), s.Name)
+}
+
+func (s *Unit) disable(ctx context.Context) error {
+	conn, err := connection(s.User)
+	if err != nil {
+		return err
+	}
+	_, err = conn.DisableUnitFilesContext(ctx, []string{s.Name}, false)
+	if err != nil {
+		return classifyErr(err, s.Name)
+	}
+	return classifyErr(conn.ReloadContext(ctx), s.Name)
+}
+
+// Properties returns all unit's properties, including type-specific ones, e.g. of `Service` interface
+func (s *Unit) Properties() (map[string]interface{}, error) {
+	conn, err := connection(s.User)
+	if err != nil {
+		return nil, err
+	}
+	result, err := conn.GetUnitPropertiesContext(context.Background(), s.Name)
+	if err != nil {
+		return nil, classifyErr(err, s.Name)
+	}
+	unitType := strings.TrimPrefix(filepath.Ext(s.Name), ".")
+	if unitType == "" {
+		return result, nil
+	}
+	// NOTE: D-Bus interfaces are named after capitalized unit types, e.g. "Service"
+	unitType = strings.ToUpper(unitType[:1]) + unitType[1:]
+	typeProps, err := conn.GetUnitTypePropertiesContext(context.Background(), s.Name, unitType)
+	if err != nil {
+		return nil, classifyErr(err, s.Name)
+	}
+	for k, v := range typeProps {
+		result[k] = v
+	}
+	return result, nil
+}
+
+// Property returns single property of `Unit` interface
+func (s *Unit) Property(name string) (interface{}, error) {
+	return s.property(context.Background(), name)
+}
+
+func (s *Unit) property(ctx context.Context, name string) (interface{}, error) {
+	conn, err := connection(s.User)
+	if err != nil {
+		return nil, err
+	}
+	prop, err := conn.GetUnitPropertyContext(ctx, s.Name, name)
+	if err != nil {
+		return nil, classifyErr(err, s.Name)
+	}
+	return prop.Value.Value(), nil
+}
+
+// State returns current unit's states, ErrNoSuchUnit is returned for units which could not be loaded
+func (s *Unit) State() (*UnitState, error) {
+	conn, err := connection(s.User)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := conn.ListUnitsByNamesContext(context.Background(), []string{s.Name})
+	if err != nil {
+		return nil, classifyErr(err, s.Name)
+	}
+	if len(statuses) == 0 || statuses[0].LoadState == "not-found" {
+		return nil, ErrNoSuchUnit{Name: s.Name}
+	}
+	result := unitState(statuses[0], s.User)
+	return &result, nil
+}
+
+func unitState(status sddbus.UnitStatus, user bool) UnitState {
+	return UnitState{
+		Unit:        Unit{Name: status.Name, User: user},
+		Description: status.Description,
+		LoadState:   status.LoadState,
+		ActiveState: status.ActiveState,
+		SubState:    status.SubState,
+	}
+}
+
+// ListUnits returns states of loaded units, optionally filtered by glob patterns, e.g. "*.timer"
+func ListUnits(user bool, patterns ...string) ([]UnitState, error) {
+	conn, err := connection(user)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := conn.ListUnitsByPatternsContext(context.Background(), nil, patterns)
+	if err != nil {
+		return nil, classifyErr(err, strings.Join(patterns, ","))
+	}
+	var result []UnitState
+	for _, status := range statuses {
+		result = append(result, unitState(status, user))
+	}
+	return result, nil
+}
+
+// listUnitFiles returns names of installed unit files, either loaded or not
+func listUnitFiles(user bool) ([]string, error) {
+	conn, err := connection(user)
+	if err != nil {
+		return nil, err
+	}
+	files, err := conn.ListUnitFilesContext(context.Background())
+	if err != nil {
+		return nil, classifyErr(err, "")
+	}
+	var result []string
+	for _, f := range files {
+		result = append(result, filepath.Base(f.Path))
+	}
+	return result, nil
+}
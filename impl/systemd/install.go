@@ -0,0 +1,414 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/wiedzmin/toolbox/impl"
+	"github.com/wiedzmin/toolbox/impl/fs"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
+)
+
+const (
+	// GeneratedUnitPrefix is prepended to names of units generated by toolbox, to tell them apart from the rest
+	GeneratedUnitPrefix = "tb-"
+
+	// NOTE: systemd ignores "X-" prefixed keys, so this is a safe way to mark generated files
+	generatedMarkerKey = "X-Toolbox-Generated"
+)
+
+var (
+	unitNameUnsafeRegexp = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+	execArgSafeRegexp    = regexp.MustCompile(`^[A-Za-z0-9_@+=:,./-]+$`)
+)
+
+type ErrInvalidSchedule struct {
+	Schedule string
+	Message  string
+}
+
+func (e ErrInvalidSchedule) Error() string {
+	return fmt.Sprintf("invalid schedule '%s': %s", e.Schedule, e.Message)
+}
+
+type ErrInvalidSpec struct {
+	Field string
+	Value string
+}
+
+func (e ErrInvalidSpec) Error() string {
+	return fmt.Sprintf("%s should be a single line, not ending with backslash: %q", e.Field, e.Value)
+}
+
+type ErrInvalidUnitName struct {
+	Name string
+}
+
+func (e ErrInvalidUnitName) Error() string {
+	return fmt.Sprintf("unit name should consist of letters, digits, '_' and '-' only: %q", e.Name)
+}
+
+type ErrNotGenerated struct {
+	Name string
+}
+
+func (e ErrNotGenerated) Error() string {
+	return fmt.Sprintf("'%s' has not been generated by toolbox, refusing to touch it", e.Name)
+}
+
+// UnitSpec describes toolbox command to be run by user manager, either periodically or as a daemon
+// Schedule is an `OnCalendar=` expression, e.g. "hourly" or "*-*-* 04:00:00", empty one means long-running daemon,
+// which gets restarted on failures; Environment entries are "KEY=VALUE" pairs
+type UnitSpec struct {
+	Name        string
+	Description string
+	Command     []string
+	Schedule    string
+	Environment []string
+}
+
+// GeneratedUnit is a unit created by toolbox, Path is empty for transient units
+type GeneratedUnit struct {
+	Unit
+	Path string
+}
+
+func (u GeneratedUnit) Transient() bool {
+	return u.Path == ""
+}
+
+// UserUnitsDir returns directory with user's own units, which take precedence over the packaged ones
+func UserUnitsDir() string {
+	return fs.AtDotConfig("systemd/user")
+}
+
+// UnitBaseName derives unit name out of command, e.g. "tb-ffsessions-rotate" for `ffsessions rotate`
+func UnitBaseName(command []string) string {
+	var words []string
+	for _, w := range command {
+		w = unitNameUnsafeRegexp.ReplaceAllString(filepath.Base(w), "-")
+		w = strings.Trim(w, "-")
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	return GeneratedUnitPrefix + strings.Join(words, "-")
+}
+
+// PassEnvironment returns toolbox settings from current environment, so that generated units behave the same way
+// command does when run by hand
+func PassEnvironment() []string {
+	var result []string
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, impl.EnvPrefix+"_") {
+			result = append(result, kv)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// quoteExecArg quotes argument for `ExecStart=`, which has its own rules, distinct from shell ones
+// NOTE: variables are expanded by systemd in command lines, hence "$" is doubled
+func quoteExecArg(arg string) string {
+	return quoteUnitValue(strings.ReplaceAll(arg, "$", "$$"))
+}
+
+// quoteUnitValue quotes single word of unit file setting, doubling "%" so that it would not be taken for specifier
+// NOTE: line breaks are C-escaped, as systemd unescapes quoted words, otherwise they would start new settings
+func quoteUnitValue(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	if execArgSafeRegexp.MatchString(arg) {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	arg = strings.ReplaceAll(arg, "\n", `\n`)
+	arg = strings.ReplaceAll(arg, "\r", `\r`)
+	return `"` + arg + `"`
+}
+
+// singleLine tells if value could be written to unit file verbatim, i.e. neither breaks line nor continues it
+func singleLine(value string) bool {
+	return !strings.ContainsAny(value, "\r\n") && !strings.HasSuffix(value, `\`)
+}
+
+func (s UnitSpec) baseName() string {
+	if s.Name == "" {
+		return UnitBaseName(s.Command)
+	}
+	if strings.HasPrefix(s.Name, GeneratedUnitPrefix) {
+		return s.Name
+	}
+	return GeneratedUnitPrefix + s.Name
+}
+
+func (s UnitSpec) description() string {
+	result := s.Description
+	if result == "" {
+		result = fmt.Sprintf("toolbox: %s", strings.Join(strings.Fields(strings.Join(s.Command, " ")), " "))
+	}
+	return strings.ReplaceAll(result, "%", "%%")
+}
+
+// Validate checks settings, which are written to unit files verbatim, as they could inject arbitrary directives otherwise
+// Command and Environment are quoted, and so need no checking; Name is checked as well, since it makes file paths,
+// which should stay within user units directory, and `--unit` of systemd-run
+func (s UnitSpec) Validate() error {
+	if s.Name != "" && unitNameUnsafeRegexp.MatchString(s.Name) {
+		return ErrInvalidUnitName{Name: s.Name}
+	}
+	if !singleLine(s.description()) {
+		return ErrInvalidSpec{Field: "description", Value: s.Description}
+	}
+	if !singleLine(s.Schedule) {
+		return ErrInvalidSpec{Field: "schedule", Value: s.Schedule}
+	}
+	return nil
+}
+
+// resolveCommand makes executable path absolute, as user manager's PATH is usually way shorter than login shell's one
+func (s UnitSpec) resolveCommand() ([]string, error) {
+	if len(s.Command) == 0 {
+		return nil, proc.ErrInvalidArgv{Argv: s.Command}
+	}
+	path, err := exec.LookPath(s.Command[0])
+	if err != nil {
+		return nil, err
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{path}, s.Command[1:]...), nil
+}
+
+// ServiceText renders service unit file
+func (s UnitSpec) ServiceText(command []string) string {
+	var words []string
+	for _, w := range command {
+		words = append(words, quoteExecArg(w))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\nDescription=%s\n%s=true\n\n[Service]\n", s.description(), generatedMarkerKey)
+	if s.Schedule != "" {
+		b.WriteString("Type=oneshot\n")
+	} else {
+		b.WriteString("Type=simple\nRestart=on-failure\nRestartSec=5\n")
+	}
+	for _, kv := range s.Environment {
+		fmt.Fprintf(&b, "Environment=%s\n", quoteUnitValue(kv))
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(words, " "))
+	// NOTE: scheduled services are pulled in by their timers, so they need no installing themselves
+	if s.Schedule == "" {
+		b.WriteString("\n[Install]\nWantedBy=default.target\n")
+	}
+	return b.String()
+}
+
+// TimerText renders timer unit file, runs missed while being powered off are caught up on
+func (s UnitSpec) TimerText() string {
+	return fmt.Sprintf("[Unit]\nDescription=%s (timer)\n%s=true\n\n[Timer]\nOnCalendar=%s\nPersistent=true\n\n[Install]\nWantedBy=timers.target\n",
+		s.description(), generatedMarkerKey, s.Schedule)
+}
+
+// ValidateSchedule checks schedule with `systemd-analyze`, so that broken timers are never installed
+func ValidateSchedule(schedule string) error {
+	out, err := proc.Output(context.Background(), []string{"systemd-analyze", "calendar", schedule}, proc.Options{CombineOutput: true})
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return ErrInvalidSchedule{Schedule: schedule, Message: strings.TrimSpace(out)}
+		}
+		return err
+	}
+	return nil
+}
+
+// activeUnit is the one to enable and start, i.e. timer for scheduled commands and service for daemons
+func (s UnitSpec) activeUnit() Unit {
+	if s.Schedule != "" {
+		return Unit{Name: s.baseName() + "." + UNIT_TYPE_TIMER, User: true}
+	}
+	return Unit{Name: s.baseName() + "." + UNIT_TYPE_SERVICE, User: true}
+}
+
+// Install writes unit files under UserUnitsDir, then enables and starts them, existing generated units get replaced
+func Install(spec UnitSpec) (*Unit, error) {
+	l := logger.Sugar()
+	err := spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+	command, err := spec.resolveCommand()
+	if err != nil {
+		return nil, err
+	}
+	if spec.Schedule != "" {
+		err = ValidateSchedule(spec.Schedule)
+		if err != nil {
+			return nil, err
+		}
+	}
+	files := map[string]string{
+		spec.baseName() + "." + UNIT_TYPE_SERVICE: spec.ServiceText(command),
+	}
+	if spec.Schedule != "" {
+		files[spec.baseName()+"."+UNIT_TYPE_TIMER] = spec.TimerText()
+	}
+	dir := UserUnitsDir()
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	// NOTE: command could have been scheduled before, left over timer would keep starting daemon otherwise
+	staleTimer := Unit{Name: spec.baseName() + "." + UNIT_TYPE_TIMER, User: true}
+	if spec.Schedule == "" && isGenerated(filepath.Join(dir, staleTimer.Name)) {
+		err = Uninstall(GeneratedUnit{Unit: staleTimer, Path: filepath.Join(dir, staleTimer.Name)})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if fs.FileExists(path) && !isGenerated(path) {
+			return nil, ErrNotGenerated{Name: name}
+		}
+		l.Debugw("[Install]", "path", path)
+		err = os.WriteFile(path, []byte(text), 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+	unit := spec.activeUnit()
+	// NOTE: enabling reloads manager, so that freshly written files are picked up
+	err = unit.Enable()
+	if err != nil {
+		return nil, err
+	}
+	return &unit, unit.Restart()
+}
+
+// RunTransient runs command as transient unit, with `systemd-run`, which leaves no files behind
+// Transient units are gone once stopped or, for daemons, once finished, and do not survive reboots
+func RunTransient(spec UnitSpec) (*Unit, error) {
+	err := spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+	command, err := spec.resolveCommand()
+	if err != nil {
+		return nil, err
+	}
+	argv := []string{"systemd-run", "--user", "--unit", spec.baseName(), "--description", spec.description()}
+	if spec.Schedule != "" {
+		err = ValidateSchedule(spec.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		argv = append(argv, "--on-calendar", spec.Schedule, "--timer-property", "Persistent=true")
+	} else {
+		argv = append(argv, "--property", "Restart=on-failure")
+	}
+	for _, kv := range spec.Environment {
+		argv = append(argv, "--setenv", kv)
+	}
+	argv = append(argv, "--")
+	argv = append(argv, command...)
+	err = proc.Run(context.Background(), argv, proc.Options{})
+	if err != nil {
+		return nil, err
+	}
+	unit := spec.activeUnit()
+	return &unit, nil
+}
+
+func isGenerated(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(data), "\n"+generatedMarkerKey+"=true\n")
+}
+
+// ListGenerated returns units created by toolbox, both the file-backed and the transient ones, sorted by name
+func ListGenerated() ([]GeneratedUnit, error) {
+	var result []GeneratedUnit
+	seen := make(map[string]bool)
+	entries, err := os.ReadDir(UserUnitsDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		path := filepath.Join(UserUnitsDir(), e.Name())
+		if e.IsDir() || !strings.HasPrefix(e.Name(), GeneratedUnitPrefix) || !isGenerated(path) {
+			continue
+		}
+		seen[e.Name()] = true
+		result = append(result, GeneratedUnit{Unit: Unit{Name: e.Name(), User: true}, Path: path})
+	}
+	states, err := ListUnits(true, GeneratedUnitPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	for _, state := range states {
+		if seen[state.Name] || state.LoadState == "not-found" {
+			continue
+		}
+		// NOTE: transient units live under runtime directory, file-backed ones not found above are someone else's
+		path, err := state.Property("FragmentPath")
+		if err != nil {
+			return nil, err
+		}
+		if p, _ := path.(string); p != "" && !strings.Contains(p, "/transient/") {
+			continue
+		}
+		result = append(result, GeneratedUnit{Unit: state.Unit})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Uninstall stops and disables generated unit along with its timer or service counterpart, removing their files
+func Uninstall(unit GeneratedUnit) error {
+	l := logger.Sugar()
+	base := strings.TrimSuffix(unit.Name, filepath.Ext(unit.Name))
+	if !strings.HasPrefix(base, GeneratedUnitPrefix) {
+		return ErrNotGenerated{Name: unit.Name}
+	}
+	// NOTE: timer goes first, so that it would not start service being stopped
+	for _, unitType := range []string{UNIT_TYPE_TIMER, UNIT_TYPE_SERVICE} {
+		u := Unit{Name: base + "." + unitType, User: true}
+		path := filepath.Join(UserUnitsDir(), u.Name)
+		if fs.FileExists(path) && !isGenerated(path) {
+			return ErrNotGenerated{Name: u.Name}
+		}
+		err := u.Stop()
+		if err != nil {
+			return err
+		}
+		if !fs.FileExists(path) {
+			continue
+		}
+		err = u.Disable()
+		if err != nil {
+			return err
+		}
+		l.Debugw("[Uninstall]", "path", path)
+		err = os.Remove(path)
+		if err != nil {
+			return err
+		}
+	}
+	conn, err := connection(true)
+	if err != nil {
+		return err
+	}
+	return classifyErr(conn.ReloadContext(context.Background()), unit.Name)
+}
@@ -0,0 +1,172 @@
+package systemd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestQuoteExecArg(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"/usr/bin/ffsessions", "/usr/bin/ffsessions"},
+		{"--count=5", "--count=5"},
+		{"", `""`},
+		{"two words", `"two words"`},
+		{"100%", `"100%%"`},
+		{"$HOME", `"$$HOME"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`back\slash`, `"back\\slash"`},
+		{"multi\nline", `"multi\nline"`},
+		{"trailing\\", `"trailing\\"`},
+	}
+	for _, tt := range tests {
+		if got := quoteExecArg(tt.arg); got != tt.want {
+			t.Errorf("quoteExecArg(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestServiceText(t *testing.T) {
+	tests := []struct {
+		name string
+		spec UnitSpec
+		want string
+	}{
+		{
+			"daemon",
+			UnitSpec{Command: []string{"watcher", "--interval", "5m"}},
+			`[Unit]
+Description=toolbox: watcher --interval 5m
+X-Toolbox-Generated=true
+
+[Service]
+Type=simple
+Restart=on-failure
+RestartSec=5
+ExecStart=/bin/watcher --interval 5m
+
+[Install]
+WantedBy=default.target
+`,
+		},
+		{
+			"scheduled, with environment and unsafe values",
+			UnitSpec{
+				Description: "Rotate 100% of sessions",
+				Command:     []string{"rotate", "$HOME/it's here", "a\nExecStartPre=/bin/evil"},
+				Schedule:    "hourly",
+				Environment: []string{"TB_STORE=files", "TB_NOTE=50% off", "TB_EVIL=x\nExecStartPre=/bin/evil"},
+			},
+			`[Unit]
+Description=Rotate 100%% of sessions
+X-Toolbox-Generated=true
+
+[Service]
+Type=oneshot
+Environment=TB_STORE=files
+Environment="TB_NOTE=50%% off"
+Environment="TB_EVIL=x\nExecStartPre=/bin/evil"
+ExecStart=/bin/rotate "$$HOME/it's here" "a\nExecStartPre=/bin/evil"
+`,
+		},
+	}
+	for _, tt := range tests {
+		command := append([]string{"/bin/" + tt.spec.Command[0]}, tt.spec.Command[1:]...)
+		if got := tt.spec.ServiceText(command); got != tt.want {
+			t.Errorf("%s: ServiceText =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTimerText(t *testing.T) {
+	spec := UnitSpec{Command: []string{"rotate"}, Schedule: "*-*-* 04:00:00"}
+	want := `[Unit]
+Description=toolbox: rotate (timer)
+X-Toolbox-Generated=true
+
+[Timer]
+OnCalendar=*-*-* 04:00:00
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`
+	if got := spec.TimerText(); got != want {
+		t.Errorf("TimerText =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUnitSpecValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  UnitSpec
+		field string
+	}{
+		{"plain", UnitSpec{Description: "Plain one", Command: []string{"a"}, Schedule: "daily"}, ""},
+		{"newlines in quoted values", UnitSpec{Command: []string{"a", "b\nc"}, Environment: []string{"K=v\nw"}}, ""},
+		{"description newline", UnitSpec{Description: "x\nExecStartPre=/bin/evil", Command: []string{"a"}}, "description"},
+		{"description carriage return", UnitSpec{Description: "x\ry", Command: []string{"a"}}, "description"},
+		{"description continuation", UnitSpec{Description: `x\`, Command: []string{"a"}}, "description"},
+		{"default description continuation", UnitSpec{Command: []string{"a", `b\`}}, "description"},
+		{"schedule newline", UnitSpec{Command: []string{"a"}, Schedule: "daily\nOnBootSec=0"}, "schedule"},
+		{"name", UnitSpec{Name: "tb-rotate_2", Command: []string{"a"}}, ""},
+	}
+	for _, tt := range tests {
+		err := tt.spec.Validate()
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%s: Validate: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		var invalid ErrInvalidSpec
+		if !errors.As(err, &invalid) || invalid.Field != tt.field {
+			t.Errorf("%s: Validate: got error %v, want ErrInvalidSpec for %s", tt.name, err, tt.field)
+		}
+	}
+
+	for _, name := range []string{"../../escaped", "sub/dir", "..", "two words", "tab\tname", "rotate.service", "x\ny"} {
+		spec := UnitSpec{Name: name, Command: []string{"a"}}
+		var invalid ErrInvalidUnitName
+		if err := spec.Validate(); !errors.As(err, &invalid) || invalid.Name != name {
+			t.Errorf("Validate(name %q): got error %v, want ErrInvalidUnitName", name, err)
+		}
+	}
+
+	// NOTE: commands spanning several lines still make single-line default description
+	spec := UnitSpec{Command: []string{"sh", "-c", "a\nb"}}
+	if got := spec.description(); strings.ContainsAny(got, "\r\n") {
+		t.Errorf("description() = %q, want single line", got)
+	}
+}
+
+func TestUnitBaseName(t *testing.T) {
+	tests := []struct {
+		command []string
+		want    string
+	}{
+		{[]string{"ffsessions", "rotate"}, "tb-ffsessions-rotate"},
+		{[]string{"/usr/bin/services", "watch", "--bus", "user"}, "tb-services-watch-bus-user"},
+		{[]string{"vpn", "--name=work vpn", "up"}, "tb-vpn-name-work-vpn-up"},
+	}
+	for _, tt := range tests {
+		if got := UnitBaseName(tt.command); got != tt.want {
+			t.Errorf("UnitBaseName(%q) = %s, want %s", tt.command, got, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		name string
+		want string
+	}{
+		{"rotate", "tb-rotate"},
+		{"tb-rotate", "tb-rotate"},
+	} {
+		spec := UnitSpec{Name: tt.name, Command: []string{"ffsessions", "rotate"}}
+		if got := spec.baseName(); got != tt.want {
+			t.Errorf("baseName(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package systemd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
+)
+
+const (
+	// JournalPriorityErrors is what journalctl treats as errors, i.e. "emerg" through "err"
+	JournalPriorityErrors = "err"
+
+	journalLinesDefault = 500
+)
+
+var journalPriorityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// JournalQuery narrows unit's journal down, empty fields mean no filtering
+// Priority, Since and Until are passed to journalctl as is, so they accept whatever it does, e.g. "warning", "-1h" or
+// "today"; Grep is matched against messages locally, as not every journalctl is built with pattern matching support
+type JournalQuery struct {
+	Priority string
+	Since    string
+	Until    string
+	ThisBoot bool
+	Grep     *regexp.Regexp
+	Lines    int
+	Reverse  bool
+}
+
+// JournalEntry is a single journal record, only the fields which are used for rendering are kept
+type JournalEntry struct {
+	Time       time.Time
+	Priority   int
+	Identifier string
+	PID        string
+	Message    string
+}
+
+// journalRecord mirrors `journalctl -o json` output, where every field is a string, except for messages, which are
+// arrays of bytes when not a valid UTF-8, or even null
+type journalRecord struct {
+	RealtimeTimestamp string              `json:"__REALTIME_TIMESTAMP"`
+	Priority          string              `json:"PRIORITY"`
+	SyslogIdentifier  string              `json:"SYSLOG_IDENTIFIER"`
+	Comm              string              `json:"_COMM"`
+	PID               string              `json:"_PID"`
+	Message           jsoniter.RawMessage `json:"MESSAGE"`
+}
+
+func (r journalRecord) entry() JournalEntry {
+	result := JournalEntry{
+		Identifier: r.SyslogIdentifier,
+		PID:        r.PID,
+		Priority:   -1,
+	}
+	if result.Identifier == "" {
+		result.Identifier = r.Comm
+	}
+	if usec, err := strconv.ParseInt(r.RealtimeTimestamp, 10, 64); err == nil {
+		result.Time = time.UnixMicro(usec)
+	}
+	if priority, err := strconv.Atoi(r.Priority); err == nil {
+		result.Priority = priority
+	}
+	var text string
+	if jsoniter.Unmarshal(r.Message, &text) == nil {
+		result.Message = text
+		return result
+	}
+	var raw []byte
+	if jsoniter.Unmarshal(r.Message, &raw) == nil {
+		result.Message = strings.ToValidUTF8(string(raw), "?")
+	}
+	return result
+}
+
+// PriorityName returns syslog name of entry priority, e.g. "err"
+func (e JournalEntry) PriorityName() string {
+	if e.Priority < 0 || e.Priority >= len(journalPriorityNames) {
+		return "-"
+	}
+	return journalPriorityNames[e.Priority]
+}
+
+func (e JournalEntry) String() string {
+	source := e.Identifier
+	if e.PID != "" {
+		source = fmt.Sprintf("%s[%s]", source, e.PID)
+	}
+	return fmt.Sprintf("%s %-7s %s: %s", e.Time.Format(time.DateTime), e.PriorityName(), source, e.Message)
+}
+
+// JournalAsText renders entries the way `journalctl` does, one entry per line
+func JournalAsText(entries []JournalEntry) string {
+	var result strings.Builder
+	for _, e := range entries {
+		result.WriteString(e.String())
+		result.WriteString("\n")
+	}
+	return result.String()
+}
+
+// journalArgv builds journalctl command line for unit, the output format is left to caller
+func (s *Unit) journalArgv(q JournalQuery) []string {
+	result := []string{"journalctl", "--no-pager"}
+	if s.User {
+		result = append(result, "--user")
+	}
+	result = append(result, "-u", s.Name)
+	if q.Priority != "" {
+		result = append(result, "-p", q.Priority)
+	}
+	if q.Since != "" {
+		result = append(result, "--since", q.Since)
+	}
+	if q.Until != "" {
+		result = append(result, "--until", q.Until)
+	}
+	if q.ThisBoot {
+		result = append(result, "-b")
+	}
+	lines := q.Lines
+	if lines == 0 {
+		lines = journalLinesDefault
+	}
+	if lines > 0 {
+		result = append(result, "-n", strconv.Itoa(lines))
+	}
+	if q.Reverse {
+		result = append(result, "-r")
+	}
+	return result
+}
+
+// JournalCmd returns shell command, equivalent to query, for the case one wants to run it by hand
+func (s *Unit) JournalCmd(q JournalQuery) string {
+	var words []string
+	for _, w := range s.journalArgv(q) {
+		words = append(words, proc.QuoteWord(w))
+	}
+	if q.Grep != nil {
+		words = append(words, "--grep", proc.QuoteWord(q.Grep.String()))
+	}
+	return strings.Join(words, " ")
+}
+
+// Journal reads unit's journal entries matching query, oldest ones first unless reversed
+// NOTE: Lines limit applies before Grep filtering, so fewer entries than requested could be returned
+func (s *Unit) Journal(q JournalQuery) ([]JournalEntry, error) {
+	l := logger.Sugar()
+	argv := append(s.journalArgv(q), "-o", "json")
+	out, err := proc.Output(context.Background(), argv, proc.Options{})
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.parseJournal(out, q.Grep)
+	if err != nil {
+		return nil, err
+	}
+	l.Debugw(fmt.Sprintf("[%s.Journal]", s.Name), "argv", argv, "entries", len(result))
+	return result, nil
+}
+
+// parseJournal parses `journalctl -o json` output, skipping malformed records and ones not matching grep, if any
+func (s *Unit) parseJournal(out string, grep *regexp.Regexp) ([]JournalEntry, error) {
+	l := logger.Sugar()
+	var result []JournalEntry
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	// NOTE: single records could be way larger than default token size, e.g. multiline stack traces
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var record journalRecord
+		err := jsoniter.Unmarshal(line, &record)
+		if err != nil {
+			l.Warnw(fmt.Sprintf("[%s.parseJournal]", s.Name), "err", err)
+			continue
+		}
+		e := record.entry()
+		if grep != nil && !grep.MatchString(e.Message) {
+			continue
+		}
+		result = append(result, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package systemd
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestJournalArgv(t *testing.T) {
+	tests := []struct {
+		name  string
+		unit  Unit
+		query JournalQuery
+		want  []string
+	}{
+		{"defaults", Unit{Name: "nginx.service"}, JournalQuery{},
+			[]string{"journalctl", "--no-pager", "-u", "nginx.service", "-n", "500"}},
+		{"user unit, all filters", Unit{Name: "tb-rotate.service", User: true},
+			JournalQuery{Priority: "warning", Since: "-1h", Until: "today", ThisBoot: true, Lines: 20, Reverse: true},
+			[]string{"journalctl", "--no-pager", "--user", "-u", "tb-rotate.service", "-p", "warning",
+				"--since", "-1h", "--until", "today", "-b", "-n", "20", "-r"}},
+		{"no lines limit", Unit{Name: "nginx.service"}, JournalQuery{Lines: -1},
+			[]string{"journalctl", "--no-pager", "-u", "nginx.service"}},
+		// NOTE: grep is applied locally, so it never gets to journalctl
+		{"grep", Unit{Name: "nginx.service"}, JournalQuery{Grep: regexp.MustCompile("fail"), Lines: 10},
+			[]string{"journalctl", "--no-pager", "-u", "nginx.service", "-n", "10"}},
+	}
+	for _, tt := range tests {
+		if got := tt.unit.journalArgv(tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: journalArgv = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJournalCmd(t *testing.T) {
+	u := Unit{Name: "nginx.service", User: true}
+	q := JournalQuery{Priority: JournalPriorityErrors, Since: "2024-06-01 12:00", Grep: regexp.MustCompile(`can't (bind|listen)`)}
+	want := `journalctl --no-pager --user -u nginx.service -p err --since '2024-06-01 12:00' -n 500 --grep 'can'\''t (bind|listen)'`
+	if got := u.JournalCmd(q); got != want {
+		t.Errorf("JournalCmd =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseJournal(t *testing.T) {
+	out := `{"__REALTIME_TIMESTAMP":"1717243200000000","PRIORITY":"3","SYSLOG_IDENTIFIER":"nginx","_PID":"42","MESSAGE":"bind failed"}
+{"__REALTIME_TIMESTAMP":"1717243201000000","PRIORITY":"6","_COMM":"nginx","_PID":"42","MESSAGE":"started"}
+
+not json at all
+{"__REALTIME_TIMESTAMP":"1717243202000000","PRIORITY":"4","SYSLOG_IDENTIFIER":"nginx","MESSAGE":[104,105,255]}
+{"__REALTIME_TIMESTAMP":"garbage","PRIORITY":"","SYSLOG_IDENTIFIER":"kernel","MESSAGE":null}
+`
+	u := Unit{Name: "nginx.service"}
+	entries, err := u.parseJournal(out, nil)
+	if err != nil {
+		t.Fatalf("parseJournal: unexpected error: %v", err)
+	}
+	want := []JournalEntry{
+		{Time: time.UnixMicro(1717243200000000), Priority: 3, Identifier: "nginx", PID: "42", Message: "bind failed"},
+		{Time: time.UnixMicro(1717243201000000), Priority: 6, Identifier: "nginx", PID: "42", Message: "started"},
+		{Time: time.UnixMicro(1717243202000000), Priority: 4, Identifier: "nginx", Message: "hi?"},
+		{Priority: -1, Identifier: "kernel"},
+	}
+	if !slices.Equal(entries, want) {
+		t.Errorf("parseJournal =\n%+v\nwant\n%+v", entries, want)
+	}
+
+	entries, err = u.parseJournal(out, regexp.MustCompile(`fail|^start`))
+	if err != nil {
+		t.Fatalf("parseJournal: unexpected error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Message != "bind failed" || entries[1].Message != "started" {
+		t.Errorf("parseJournal with grep = %+v", entries)
+	}
+}
+
+func TestJournalEntryString(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		entry JournalEntry
+		want  string
+	}{
+		{JournalEntry{Time: at, Priority: 3, Identifier: "nginx", PID: "42", Message: "bind failed"},
+			"2024-06-01 12:00:00 err     nginx[42]: bind failed"},
+		{JournalEntry{Time: at, Priority: 7, Identifier: "kernel", Message: "probe"},
+			"2024-06-01 12:00:00 debug   kernel: probe"},
+		{JournalEntry{Time: at, Priority: -1, Identifier: "app", Message: "?"},
+			"2024-06-01 12:00:00 -       app: ?"},
+		{JournalEntry{Time: at, Priority: 8, Identifier: "app", Message: "?"},
+			"2024-06-01 12:00:00 -       app: ?"},
+	}
+	for _, tt := range tests {
+		if got := tt.entry.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
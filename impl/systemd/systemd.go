@@ -1,11 +1,15 @@
 package systemd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/wiedzmin/toolbox/impl"
 	"github.com/wiedzmin/toolbox/impl/shell"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
 	"github.com/wiedzmin/toolbox/impl/xserver"
 	"go.uber.org/zap"
 )
@@ -43,35 +47,22 @@ func (u Unit) String() string {
 	return fmt.Sprintf("%s [%s]", u.Name, u.OwnerString())
 }
 
-func UnitFromString(s string) Unit {
-	var result Unit
-	unitChunks := strings.Split(s, " ")
-	result.Name = unitChunks[0]
-	switch strings.Trim(unitChunks[1], "[]") {
-	case "user":
-		result.User = true
-	case "system":
-		result.User = false
+func sysctlArgv(user bool, cmd, name string, args ...string) []string {
+	result := []string{"systemctl"}
+	if user {
+		result = append(result, "--user")
 	}
-	return result
+	result = append(result, cmd)
+	result = append(result, args...)
+	return append(result, name)
 }
 
 func sysctlCmd(user bool, cmd, name string, args ...string) string {
-	var tokens []string
-	if user {
-		tokens = []string{"systemctl", "--user", cmd}
-	} else {
-		tokens = []string{"systemctl", cmd}
-	}
-	tokens = append(tokens, args...)
-	tokens = append(tokens, name)
-	var result strings.Builder
-	for _, t := range tokens {
-		result.WriteString(fmt.Sprintf("%s ", t))
-	}
-	r := strings.TrimSpace(result.String())
+	return strings.Join(sysctlArgv(user, cmd, name, args...), " ")
+}
 
-	return r
+func runSysctl(ctx context.Context, user bool, cmd, name string, args ...string) error {
+	return proc.Run(ctx, sysctlArgv(user, cmd, name, args...), proc.Options{})
 }
 
 func jctlCmd(user, follow bool, name string) string {
@@ -92,65 +83,64 @@ func jctlCmd(user, follow bool, name string) string {
 	return r
 }
 
-// TODO: IDEA: make timers on status-changing operations, which would issue notification after some timeout asking to wait a bit more
-
 // Restart restarts unit
 func (s *Unit) Restart() error {
-	_, err := shell.ShellCmd(sysctlCmd(s.User, "restart", s.Name), nil, nil, nil, false, false)
-	return err
+	return s.withFallback(context.Background(), s.restart, "restart")
 }
 
 // Start starts unit
 func (s *Unit) Start() error {
-	_, err := shell.ShellCmd(sysctlCmd(s.User, "start", s.Name), nil, nil, nil, false, false)
-	return err
+	return s.withFallback(context.Background(), s.start, "start")
 }
 
-// Stop stops unit
+// Stop stops unit, unit absence is treated as success
 func (s *Unit) Stop() error {
-	// TODO: unit absence should be treated as success
-	_, err := shell.ShellCmd(sysctlCmd(s.User, "stop", s.Name), nil, nil, nil, false, false)
+	err := s.withFallback(context.Background(), s.stop, "stop")
+	var noSuchUnit ErrNoSuchUnit
+	if errors.As(err, &noSuchUnit) {
+		return nil
+	}
 	return err
 }
 
-// Kill kills unit
+// Kill kills all unit's processes, unit absence is treated as success
 func (s *Unit) Kill() error {
-	// TODO: unit absence should be treated as success
-	_, err := shell.ShellCmd(sysctlCmd(s.User, "kill", s.Name, "--signal=SIGKILL"), nil, nil, nil, false, false)
+	err := s.withFallback(context.Background(), s.kill, "kill", "--signal=SIGKILL")
+	var noSuchUnit ErrNoSuchUnit
+	if errors.As(err, &noSuchUnit) {
+		return nil
+	}
 	return err
 }
 
 // Enable enables unit
 func (s *Unit) Enable() error {
-	_, err := shell.ShellCmd(sysctlCmd(s.User, "enable", s.Name), nil, nil, nil, false, false)
-	return err
+	return s.withFallback(context.Background(), s.enable, "enable")
 }
 
 // Disable disables unit
 func (s *Unit) Disable() error {
-	_, err := shell.ShellCmd(sysctlCmd(s.User, "disable", s.Name), nil, nil, nil, false, false)
-	return err
+	return s.withFallback(context.Background(), s.disable, "disable")
 }
 
-// IsActive checks if the unit is active
+// IsActive checks if the unit is active, transitional states are treated as inactive ones
 func (s *Unit) IsActive() (bool, error) {
 	l := logger.Sugar()
-	out, err := shell.ShellCmd(sysctlCmd(s.User, "is-active", s.Name), nil, nil, nil, true, true)
+	state, err := s.Property("ActiveState")
 	if err != nil {
 		return false, err
 	}
-	result := strings.TrimSpace(*out)
-	l.Debugw(fmt.Sprintf("[%s.IsActive]", s.Name), "result", result)
+	l.Debugw(fmt.Sprintf("[%s.IsActive]", s.Name), "state", state)
 
-	switch result {
-	case "active":
+	switch state {
+	case ActiveStateActive, ActiveStateReloading:
 		return true, nil
-	case "inactive":
+	case ActiveStateInactive, ActiveStateFailed, ActiveStateDeactivating:
 		return false, nil
-	case "activating": // NOTE: immediately after killing, for example
+	case ActiveStateActivating: // NOTE: immediately after killing, for example
 		return false, nil
 	default:
-		return false, fmt.Errorf("unknown status '%s'", *out)
+		return false, ErrUnknownState{Name: s.Name, State: fmt.Sprintf("%v", state)}
 	}
 }
 
@@ -158,35 +148,43 @@ func (s *Unit) IsActive() (bool, error) {
 func DaemonReload() error {
 	l := logger.Sugar()
 	l.Debugw("[DaemonReload]")
-	_, err := shell.ShellCmd(fmt.Sprintf("%s systemctl daemon-reload", shell.PkexecPath()), nil, nil, nil, false, false)
+	conn, err := connection(false)
+	if err == nil {
+		err = classifyErr(conn.ReloadContext(context.Background()), "")
+	}
+	if _, ok := err.(ErrAccessDenied); !ok {
+		return err
+	}
+	l.Debugw("[DaemonReload]", "summary", "falling back to pkexec", "err", err)
+	_, err = shell.ShellCmd(fmt.Sprintf("%s systemctl daemon-reload", shell.PkexecPath()), nil, nil, nil, false, false)
 	return err
 }
 
-// CollectUnits returns slice of active units (services + timers)
+// CollectUnits returns slice of installed units (services + timers)
 func CollectUnits(system, user bool) ([]Unit, error) {
 	l := logger.Sugar()
 	var units []Unit
 	var cases = []struct {
-		isUser bool
-		cmd    string
+		isUser  bool
+		enabled bool
 	}{
-		{false, "systemctl list-unit-files"},
-		{true, "systemctl --user list-unit-files"},
+		{false, system},
+		{true, user},
 	}
 	l.Debugw("[CollectUnits]", "system", system, "user", user)
 	for _, c := range cases {
-		out, err := shell.ShellCmd(c.cmd, nil, nil, nil, true, false)
+		if !c.enabled {
+			continue
+		}
+		names, err := listUnitFiles(c.isUser)
 		if err != nil {
 			return nil, err
 		}
-		unitsSlice := strings.Split(*out, "\n")
-		for _, unit := range unitsSlice[1 : len(unitsSlice)-1] {
-			if len(unit) > 0 {
-				unit = strings.Fields(unit)[0]
-				if strings.HasSuffix(unit, UNIT_TYPE_SERVICE) || strings.HasSuffix(unit, UNIT_TYPE_TIMER) {
-					l.Debugw("[CollectUnits]", "unit", unit)
-					units = append(units, Unit{Name: unit, User: c.isUser})
-				}
+		sort.Strings(names)
+		for _, unit := range names {
+			if strings.HasSuffix(unit, UNIT_TYPE_SERVICE) || strings.HasSuffix(unit, UNIT_TYPE_TIMER) {
+				l.Debugw("[CollectUnits]", "unit", unit)
+				units = append(units, Unit{Name: unit, User: c.isUser})
 			}
 		}
 	}
@@ -194,7 +192,9 @@ func CollectUnits(system, user bool) ([]Unit, error) {
 }
 
 // TODO: consider adding something similar for non-interactive commands (Start/Stop, etc.)
-func doShow(cmd, title string, terminalTraits shell.TerminalTraits, dumpCmd bool) error {
+// hold is meant for transient commands, which would otherwise flash and close along with terminal
+func doShow(cmd, title string, terminalTraits shell.TerminalTraits, hold, dumpCmd bool) error {
+	terminalTraits.Hold = terminalTraits.Hold || hold
 	if dumpCmd {
 		return xserver.WriteClipboard(&cmd, false)
 	} else {
@@ -204,24 +204,25 @@ func doShow(cmd, title string, terminalTraits shell.TerminalTraits, dumpCmd bool
 
 // Show shows unit's settings
 func (s *Unit) Show(terminalTraits shell.TerminalTraits, dumpCmd bool) error {
-	return doShow(sysctlCmd(s.User, "show", s.Name), fmt.Sprintf("show :: %s", s.Name), terminalTraits, dumpCmd)
+	return doShow(sysctlCmd(s.User, "show", s.Name), fmt.Sprintf("show :: %s", s.Name), terminalTraits, true, dumpCmd)
 }
 
 // ShowStatus shows unit's status in form of `systemctl status` output
 func (s *Unit) ShowStatus(terminalTraits shell.TerminalTraits, dumpCmd bool) error {
-	return doShow(sysctlCmd(s.User, "status", s.Name), fmt.Sprintf("status :: %s", s.Name), terminalTraits, dumpCmd)
+	return doShow(sysctlCmd(s.User, "status", s.Name), fmt.Sprintf("status :: %s", s.Name), terminalTraits, true, dumpCmd)
 }
 
 // ShowJournal shows unit's journal in form of `journalctl` output
 func (s *Unit) ShowJournal(terminalTraits shell.TerminalTraits, follow, dumpCmd bool) error {
+	// NOTE: journal is either followed or paged, so it is never transient and needs no holding
 	if follow {
-		return doShow(jctlCmd(s.User, follow, s.Name), fmt.Sprintf("journal/follow :: %s", s.Name), terminalTraits, dumpCmd)
+		terminalTraits.Hold = false
+		return doShow(jctlCmd(s.User, follow, s.Name), fmt.Sprintf("journal/follow :: %s", s.Name), terminalTraits, false, dumpCmd)
 	}
-	return doShow(jctlCmd(s.User, follow, s.Name), fmt.Sprintf("journal :: %s", s.Name), terminalTraits, dumpCmd)
+	return doShow(jctlCmd(s.User, follow, s.Name), fmt.Sprintf("journal :: %s", s.Name), terminalTraits, false, dumpCmd)
 }
 
-// TryRestart tries to restart unit
+// TryRestart restarts unit only if it is running
 func (s *Unit) TryRestart() error {
-	_, err := shell.ShellCmd(sysctlCmd(s.User, "try-restart", s.Name), nil, nil, nil, false, false)
-	return err
+	return s.withFallback(context.Background(), s.tryRestart, "try-restart")
 }
@@ -0,0 +1,111 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const timerInterface = "Timer"
+
+// Timer describes timer unit along with the unit it triggers
+// Zero times mean timer either is not scheduled or has never been triggered, LastResult is the result of triggered
+// unit's last run, e.g. "success" or "exit-code"
+type Timer struct {
+	Unit
+	Triggers    string
+	NextElapse  time.Time
+	LastTrigger time.Time
+	LastResult  string
+}
+
+// TriggeredUnit returns unit, timer activates
+func (t Timer) TriggeredUnit() Unit {
+	return Unit{Name: t.Triggers, User: t.User}
+}
+
+// Trigger starts triggered unit right away, regardless of schedule, waiting for it to become active
+func (t Timer) Trigger(opts WaitOptions) error {
+	if t.Triggers == "" {
+		return fmt.Errorf("'%s' does not trigger any unit", t.Name)
+	}
+	unit := t.TriggeredUnit()
+	return unit.StartAndWait(opts)
+}
+
+// usecToTime converts systemd timestamps, which are microseconds since epoch with both zero and max value meaning "never"
+func usecToTime(value interface{}) time.Time {
+	usec, ok := value.(uint64)
+	if !ok || usec == 0 || usec == math.MaxUint64 {
+		return time.Time{}
+	}
+	return time.UnixMicro(int64(usec))
+}
+
+// Timer returns timer data, unit should be a timer one
+func (s *Unit) Timer() (*Timer, error) {
+	conn, err := connection(s.User)
+	if err != nil {
+		return nil, err
+	}
+	props, err := conn.GetUnitTypePropertiesContext(context.Background(), s.Name, timerInterface)
+	if err != nil {
+		return nil, classifyErr(err, s.Name)
+	}
+	result := Timer{
+		Unit:        *s,
+		NextElapse:  usecToTime(props["NextElapseUSecRealtime"]),
+		LastTrigger: usecToTime(props["LastTriggerUSec"]),
+	}
+	result.Triggers, _ = props["Unit"].(string)
+	if result.Triggers == "" {
+		return &result, nil
+	}
+	// NOTE: timers could trigger any unit type, yet only services report results of their runs
+	if filepath.Ext(result.Triggers) == "."+UNIT_TYPE_SERVICE {
+		prop, err := conn.GetUnitTypePropertyContext(context.Background(), result.Triggers, "Service", "Result")
+		if err != nil {
+			return nil, classifyErr(err, result.Triggers)
+		}
+		result.LastResult, _ = prop.Value.Value().(string)
+	}
+	return &result, nil
+}
+
+// ListTimers returns loaded timers of requested managers, sorted by next elapse, unscheduled ones go last
+func ListTimers(system, user bool) ([]Timer, error) {
+	l := logger.Sugar()
+	var buses []bool
+	if system {
+		buses = append(buses, false)
+	}
+	if user {
+		buses = append(buses, true)
+	}
+	var result []Timer
+	for _, isUser := range buses {
+		states, err := ListUnits(isUser, "*."+UNIT_TYPE_TIMER)
+		if err != nil {
+			return nil, err
+		}
+		for _, state := range states {
+			timer, err := state.Unit.Timer()
+			if err != nil {
+				l.Warnw("[ListTimers]", "timer", state.Unit.String(), "err", err)
+				continue
+			}
+			result = append(result, *timer)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i].NextElapse, result[j].NextElapse
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+		return a.Before(b)
+	})
+	return result, nil
+}
@@ -0,0 +1,174 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const statePollInterval = 250 * time.Millisecond
+
+type ErrWaitTimeout struct {
+	Name      string
+	Operation string
+}
+
+func (e ErrWaitTimeout) Error() string {
+	return fmt.Sprintf("timed out waiting for %s of '%s'", e.Operation, e.Name)
+}
+
+type ErrUnexpectedState struct {
+	Name     string
+	Expected string
+	Actual   string
+}
+
+func (e ErrUnexpectedState) Error() string {
+	return fmt.Sprintf("'%s' is %s, while expected to be %s", e.Name, e.Actual, e.Expected)
+}
+
+// WaitOptions tune waiting for status-changing operations, zero Timeout means waiting indefinitely
+// OnSlow, if set, is called every SlowAfter while operation is still in progress, e.g. to ask user to wait a bit more
+type WaitOptions struct {
+	Timeout   time.Duration
+	SlowAfter time.Duration
+	OnSlow    func(elapsed time.Duration)
+}
+
+func isTransitional(state string) bool {
+	return state == ActiveStateActivating || state == ActiveStateDeactivating || state == ActiveStateReloading
+}
+
+// pollState polls unit's active state until done reports true for it, or until ctx is done
+func (s *Unit) pollState(ctx context.Context, operation string, done func(state string) bool) (string, error) {
+	l := logger.Sugar()
+	ticker := time.NewTicker(statePollInterval)
+	defer ticker.Stop()
+	for {
+		value, err := s.property(ctx, "ActiveState")
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ErrWaitTimeout{Name: s.Name, Operation: operation}
+			}
+			return "", err
+		}
+		state := fmt.Sprintf("%v", value)
+		if done(state) {
+			l.Debugw(fmt.Sprintf("[%s.pollState]", s.Name), "operation", operation, "state", state)
+			return state, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ErrWaitTimeout{Name: s.Name, Operation: operation}
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitFor waits until unit reaches provided active state, e.g. ActiveStateActive
+// Unit failure is reported as ErrUnexpectedState, unless failure is what is being waited for
+func (s *Unit) WaitFor(state string, timeout time.Duration) error {
+	ctx, cancel := withTimeout(timeout)
+	defer cancel()
+	actual, err := s.pollState(ctx, "transition to "+state, func(current string) bool {
+		return current == state || current == ActiveStateFailed
+	})
+	if err != nil {
+		return err
+	}
+	if actual != state {
+		return ErrUnexpectedState{Name: s.Name, Expected: state, Actual: actual}
+	}
+	return nil
+}
+
+func withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// watchSlow calls OnSlow every SlowAfter, if set, until returned function is called
+// NOTE: callers usually report outcome the same way OnSlow reports progress, e.g. with tagged notification, so stopping
+// waits for OnSlow call in progress, if any, and no calls happen afterwards, otherwise outcome could be overridden
+func watchSlow(opts WaitOptions) func() {
+	if opts.OnSlow == nil || opts.SlowAfter <= 0 {
+		return func() {}
+	}
+	started := time.Now()
+	ticker := time.NewTicker(opts.SlowAfter)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				select {
+				case <-done:
+					return
+				default:
+					opts.OnSlow(time.Since(started))
+				}
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		wg.Wait()
+	}
+}
+
+// andWait runs operation, waiting for its job to finish and then for unit to settle down
+// NOTE: finished job does not always mean settled unit, e.g. for services with `Type=forking`, yet settled unit is not
+// always in the expected state either, like oneshot services which become inactive right after successful start,
+// so only failures to become active are reported
+func (s *Unit) andWait(operation string, fn func(context.Context) error, expected string, opts WaitOptions) error {
+	l := logger.Sugar()
+	ctx, cancel := withTimeout(opts.Timeout)
+	defer cancel()
+	stop := watchSlow(opts)
+	defer stop()
+	err := s.withFallback(ctx, fn, operation)
+	if err != nil {
+		return err
+	}
+	state, err := s.pollState(ctx, operation, func(current string) bool {
+		return !isTransitional(current)
+	})
+	if err != nil {
+		return err
+	}
+	l.Debugw(fmt.Sprintf("[%s.andWait]", s.Name), "operation", operation, "state", state, "expected", expected)
+	if expected == ActiveStateActive && state == ActiveStateFailed {
+		return ErrUnexpectedState{Name: s.Name, Expected: expected, Actual: state}
+	}
+	return nil
+}
+
+// StartAndWait starts unit, waiting for it to become active
+func (s *Unit) StartAndWait(opts WaitOptions) error {
+	return s.andWait("start", s.start, ActiveStateActive, opts)
+}
+
+// RestartAndWait restarts unit, waiting for it to become active again
+func (s *Unit) RestartAndWait(opts WaitOptions) error {
+	return s.andWait("restart", s.restart, ActiveStateActive, opts)
+}
+
+// StopAndWait stops unit, waiting for it to become inactive, unit absence is treated as success
+func (s *Unit) StopAndWait(opts WaitOptions) error {
+	err := s.andWait("stop", s.stop, ActiveStateInactive, opts)
+	var noSuchUnit ErrNoSuchUnit
+	if errors.As(err, &noSuchUnit) {
+		return nil
+	}
+	return err
+}
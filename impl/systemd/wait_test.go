@@ -0,0 +1,36 @@
+package systemd
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchSlow(t *testing.T) {
+	var calls atomic.Int32
+	var inProgress atomic.Bool
+	stop := watchSlow(WaitOptions{SlowAfter: time.Millisecond, OnSlow: func(time.Duration) {
+		inProgress.Store(true)
+		calls.Add(1)
+		// NOTE: slow callback makes stopping in the middle of the call way more likely
+		time.Sleep(5 * time.Millisecond)
+		inProgress.Store(false)
+	}})
+	time.Sleep(20 * time.Millisecond)
+	stop()
+	if inProgress.Load() {
+		t.Errorf("OnSlow is still in progress after stop")
+	}
+	stopped := calls.Load()
+	if stopped == 0 {
+		t.Errorf("OnSlow has never been called")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := calls.Load(); got != stopped {
+		t.Errorf("OnSlow has been called %d times after stop", got-stopped)
+	}
+
+	// NOTE: nothing to watch without either callback or interval
+	watchSlow(WaitOptions{SlowAfter: time.Millisecond})()
+	watchSlow(WaitOptions{OnSlow: func(time.Duration) { t.Errorf("OnSlow called with no interval") }})()
+}
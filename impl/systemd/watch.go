@@ -0,0 +1,132 @@
+package systemd
+
+import (
+	"context"
+	"time"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/wiedzmin/toolbox/impl/store"
+)
+
+const (
+	FailuresKeyName = "system/services/failed"
+
+	// FailuresHistorySize is how many recent failures are kept
+	FailuresHistorySize = 50
+
+	watchBufferSize = 256
+)
+
+// StateChange is a transition of unit's active state
+type StateChange struct {
+	Unit
+	ActiveState string
+	SubState    string
+	Time        time.Time
+}
+
+// Failure is a record of unit entering failed state
+type Failure struct {
+	Name     string `json:"name"`
+	User     bool   `json:"user"`
+	SubState string `json:"sub"`
+	Time     int64  `json:"time"`
+}
+
+func (f Failure) Unit() Unit {
+	return Unit{Name: f.Name, User: f.User}
+}
+
+// WatchStates streams active state changes of units of requested managers, until ctx is done
+// Changes are pushed by systemd over D-Bus, so nothing is polled; errors channel reports updates dropped on overflow
+func WatchStates(ctx context.Context, system, user bool) (<-chan StateChange, <-chan error, error) {
+	l := logger.Sugar()
+	changes := make(chan StateChange, watchBufferSize)
+	errs := make(chan error, watchBufferSize)
+	var buses []bool
+	if system {
+		buses = append(buses, false)
+	}
+	if user {
+		buses = append(buses, true)
+	}
+	for _, isUser := range buses {
+		conn, err := connection(isUser)
+		if err != nil {
+			return nil, nil, err
+		}
+		updates := make(chan *sddbus.PropertiesUpdate, watchBufferSize)
+		conn.SetPropertiesSubscriber(updates, errs)
+		go func(conn *sddbus.Conn, isUser bool) {
+			defer conn.SetPropertiesSubscriber(nil, nil)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case update := <-updates:
+					activeState, ok := update.Changed["ActiveState"]
+					if !ok {
+						continue
+					}
+					change := StateChange{
+						Unit: Unit{Name: update.UnitName, User: isUser},
+						Time: time.Now(),
+					}
+					change.ActiveState, ok = activeState.Value().(string)
+					if !ok {
+						continue
+					}
+					if subState, ok := update.Changed["SubState"]; ok {
+						change.SubState, _ = subState.Value().(string)
+					}
+					l.Debugw("[WatchStates]", "unit", change.Unit.String(), "state", change.ActiveState, "sub", change.SubState)
+					changes <- change
+				}
+			}
+		}(conn, isUser)
+	}
+	return changes, errs, nil
+}
+
+// RecentFailures returns failures history, the most recent ones first
+func RecentFailures() ([]Failure, error) {
+	r, err := store.Shared()
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.GetValue(FailuresKeyName)
+	if err != nil {
+		return nil, err
+	}
+	var result []Failure
+	if len(data) == 0 {
+		return result, nil
+	}
+	err = jsoniter.Unmarshal(data, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RecordFailure prepends failure to history, dropping the oldest entries beyond FailuresHistorySize
+func RecordFailure(f Failure) error {
+	failures, err := RecentFailures()
+	if err != nil {
+		return err
+	}
+	failures = append([]Failure{f}, failures...)
+	if len(failures) > FailuresHistorySize {
+		failures = failures[:FailuresHistorySize]
+	}
+	data, err := jsoniter.Marshal(failures)
+	if err != nil {
+		return err
+	}
+	r, err := store.Shared()
+	if err != nil {
+		return err
+	}
+	return r.SetValue(FailuresKeyName, string(data))
+}
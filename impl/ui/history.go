@@ -0,0 +1,228 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/urfave/cli/v2"
+	"github.com/wiedzmin/toolbox/impl"
+	"github.com/wiedzmin/toolbox/impl/store"
+)
+
+const (
+	NoHistoryFlagName = "no-history"
+
+	HistoryKeyPrefix = "ui/history/"
+)
+
+var (
+	NoHistoryEnvVarName = fmt.Sprintf("%s_NO_HISTORY", impl.EnvPrefix)
+
+	historyNamespace string
+	historyMutex     sync.Mutex
+
+	// NOTE: the same buckets Firefox uses for its frecency, more or less
+	frecencyBuckets = []struct {
+		age    time.Duration
+		weight float64
+	}{
+		{4 * time.Hour, 4},
+		{24 * time.Hour, 2},
+		{7 * 24 * time.Hour, 1},
+		{30 * 24 * time.Hour, 0.5},
+	}
+	frecencyWeightStale = 0.25
+)
+
+// HistoryEntry keeps track of how often and how recently some option has been selected
+type HistoryEntry struct {
+	Count int   `json:"count"`
+	Last  int64 `json:"last"`
+}
+
+// Score returns frecency of entry, i.e. selections count weighted by how long ago the last selection happened
+func (e HistoryEntry) Score(now time.Time) float64 {
+	age := now.Sub(time.Unix(e.Last, 0))
+	for _, bucket := range frecencyBuckets {
+		if age < bucket.age {
+			return float64(e.Count) * bucket.weight
+		}
+	}
+	return float64(e.Count) * frecencyWeightStale
+}
+
+// History maps option display strings to respective entries
+type History map[string]HistoryEntry
+
+// HistoryCLIFlags returns flags for controlling selection history, to be appended to command's own ones
+func HistoryCLIFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:     NoHistoryFlagName,
+			EnvVars:  []string{NoHistoryEnvVarName},
+			Usage:    "Do not rank selection options by history, neither record selections made",
+			Required: false,
+		},
+	}
+}
+
+// EnableHistory turns frecency ranking on for subsequent selections, with history being kept under provided namespace
+// Empty namespace disables history
+func EnableHistory(namespace string) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	historyNamespace = namespace
+}
+
+// EnableHistoryFromContext turns frecency ranking on for current command, unless disabled from CLI
+func EnableHistoryFromContext(ctx *cli.Context) {
+	if ctx.Bool(NoHistoryFlagName) {
+		EnableHistory("")
+		return
+	}
+	EnableHistory(strings.ToLower(ctx.App.Name))
+}
+
+func historyKey(prompt string) string {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	if historyNamespace == "" {
+		return ""
+	}
+	return HistoryKeyPrefix + historyNamespace + ":" + strings.ReplaceAll(strings.TrimSpace(prompt), "/", "_")
+}
+
+// HistoryFromStore returns selection history, stored under provided key
+// Missing key means empty history
+func HistoryFromStore(key string) (History, error) {
+	r, err := store.Shared()
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.GetValue(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewHistory(data)
+}
+
+// NewHistory parses selection history from raw data
+func NewHistory(data []byte) (History, error) {
+	result := make(History)
+	if len(data) == 0 {
+		return result, nil
+	}
+	err := jsoniter.Unmarshal(data, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Save persists history under provided key
+func (h History) Save(key string) error {
+	r, err := store.Shared()
+	if err != nil {
+		return err
+	}
+	data, err := jsoniter.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return r.SetValue(key, string(data))
+}
+
+// Record bumps entries for selected options
+func (h History) Record(now time.Time, displays ...string) {
+	for _, d := range displays {
+		entry := h[d]
+		entry.Count++
+		entry.Last = now.Unix()
+		h[d] = entry
+	}
+}
+
+// Prune drops entries which were last selected earlier than maxAge ago, returning the number of entries dropped
+// Counts of remaining ones are halved for entries older than half of maxAge, so that stale favorites fade away
+func (h History) Prune(now time.Time, maxAge time.Duration) int {
+	var dropped int
+	for d, entry := range h {
+		age := now.Sub(time.Unix(entry.Last, 0))
+		switch {
+		case age > maxAge:
+			delete(h, d)
+			dropped++
+		case age > maxAge/2 && entry.Count > 1:
+			entry.Count = int(math.Ceil(float64(entry.Count) / 2))
+			h[d] = entry
+		}
+	}
+	return dropped
+}
+
+// orderItems sorts items alphabetically and then, if history is enabled, by frecency of previous selections
+func orderItems(items []Item, prompt string) []Item {
+	l := logger.Sugar()
+	result := make([]Item, len(items))
+	copy(result, items)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Display < result[j].Display
+	})
+	key := historyKey(prompt)
+	if key == "" {
+		return result
+	}
+	history, err := HistoryFromStore(key)
+	if err != nil {
+		l.Warnw("[orderItems]", "key", key, "err", err)
+		return result
+	}
+	now := time.Now()
+	sort.SliceStable(result, func(i, j int) bool {
+		return history[result[i].Display].Score(now) > history[result[j].Display].Score(now)
+	})
+	return result
+}
+
+// recordSelection stores selected items into history, if it is enabled
+// Failures are only logged, as history is merely a convenience
+func recordSelection(prompt string, items ...Item) {
+	l := logger.Sugar()
+	key := historyKey(prompt)
+	if key == "" || len(items) == 0 {
+		return
+	}
+	history, err := HistoryFromStore(key)
+	if err != nil {
+		l.Warnw("[recordSelection]", "key", key, "err", err)
+		return
+	}
+	var displays []string
+	for _, item := range items {
+		displays = append(displays, item.Display)
+	}
+	history.Record(time.Now(), displays...)
+	err = history.Save(key)
+	if err != nil {
+		l.Warnw("[recordSelection]", "key", key, "err", err)
+	}
+}
+
+// WithHistory chains enabling selection history after provided `cli.App.Before` function, which could be nil
+func WithHistory(before cli.BeforeFunc) cli.BeforeFunc {
+	return func(ctx *cli.Context) error {
+		if before != nil {
+			err := before(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		EnableHistoryFromContext(ctx)
+		return nil
+	}
+}
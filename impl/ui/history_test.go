@@ -0,0 +1,155 @@
+package ui
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/wiedzmin/toolbox/impl/store"
+)
+
+func TestHistoryEntryScore(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		count int
+		age   time.Duration
+		want  float64
+	}{
+		{1, 0, 4},
+		{3, time.Hour, 12},
+		{3, 5 * time.Hour, 6},
+		{3, 3 * 24 * time.Hour, 3},
+		{4, 10 * 24 * time.Hour, 2},
+		{4, 60 * 24 * time.Hour, 1},
+		{0, time.Hour, 0},
+	}
+	for _, tt := range tests {
+		e := HistoryEntry{Count: tt.count, Last: now.Add(-tt.age).Unix()}
+		if got := e.Score(now); got != tt.want {
+			t.Errorf("HistoryEntry{Count: %d}.Score() at age %s = %v, want %v", tt.count, tt.age, got, tt.want)
+		}
+	}
+
+	// NOTE: options never selected before have zero score, so that any selected one outranks them
+	var missing HistoryEntry
+	if got := missing.Score(now); got != 0 {
+		t.Errorf("zero HistoryEntry.Score() = %v, want 0", got)
+	}
+}
+
+func TestHistoryRecord(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	h := make(History)
+	h.Record(now.Add(-time.Hour), "a")
+	h.Record(now, "a", "b")
+	if got, want := h["a"], (HistoryEntry{Count: 2, Last: now.Unix()}); got != want {
+		t.Errorf("h[a] = %+v, want %+v", got, want)
+	}
+	if got, want := h["b"], (HistoryEntry{Count: 1, Last: now.Unix()}); got != want {
+		t.Errorf("h[b] = %+v, want %+v", got, want)
+	}
+}
+
+func TestHistoryPrune(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	maxAge := 30 * 24 * time.Hour
+	at := func(age time.Duration) int64 {
+		return now.Add(-age).Unix()
+	}
+	h := History{
+		"fresh":          {Count: 5, Last: at(time.Hour)},
+		"aging":          {Count: 5, Last: at(20 * 24 * time.Hour)},
+		"aging-single":   {Count: 1, Last: at(20 * 24 * time.Hour)},
+		"stale":          {Count: 100, Last: at(31 * 24 * time.Hour)},
+		"exactly-maxage": {Count: 2, Last: at(maxAge)},
+	}
+	want := History{
+		"fresh":          {Count: 5, Last: at(time.Hour)},
+		"aging":          {Count: 3, Last: at(20 * 24 * time.Hour)},
+		"aging-single":   {Count: 1, Last: at(20 * 24 * time.Hour)},
+		"exactly-maxage": {Count: 1, Last: at(maxAge)},
+	}
+	if dropped := h.Prune(now, maxAge); dropped != 1 {
+		t.Errorf("Prune() dropped %d entries, want 1", dropped)
+	}
+	if len(h) != len(want) {
+		t.Errorf("Prune() left %d entries, want %d", len(h), len(want))
+	}
+	for d, e := range want {
+		if h[d] != e {
+			t.Errorf("Prune(): h[%s] = %+v, want %+v", d, h[d], e)
+		}
+	}
+}
+
+func TestNewHistory(t *testing.T) {
+	for _, data := range [][]byte{nil, {}} {
+		h, err := NewHistory(data)
+		if err != nil || h == nil || len(h) != 0 {
+			t.Errorf("NewHistory(%q) = %v, %v, want empty history", data, h, err)
+		}
+	}
+	h, err := NewHistory([]byte(`{"a":{"count":2,"last":100}}`))
+	if err != nil {
+		t.Fatalf("NewHistory: unexpected error: %v", err)
+	}
+	if got, want := h["a"], (HistoryEntry{Count: 2, Last: 100}); got != want {
+		t.Errorf("h[a] = %+v, want %+v", got, want)
+	}
+	_, err = NewHistory([]byte("not json"))
+	if err == nil {
+		t.Errorf("NewHistory(not json): expected error")
+	}
+}
+
+func TestOrderItems(t *testing.T) {
+	store.Use(store.NewMemory(nil))
+	t.Cleanup(func() {
+		EnableHistory("")
+		store.Use(nil)
+	})
+	items := []Item{{Display: "c"}, {Display: "a"}, {Display: "d"}, {Display: "b"}}
+	displays := func(items []Item) []string {
+		var result []string
+		for _, item := range items {
+			result = append(result, item.Display)
+		}
+		return result
+	}
+
+	EnableHistory("")
+	if got, want := displays(orderItems(items, "pick")), []string{"a", "b", "c", "d"}; !slices.Equal(got, want) {
+		t.Errorf("orderItems without history = %q, want %q", got, want)
+	}
+	if got, want := displays(items), []string{"c", "a", "d", "b"}; !slices.Equal(got, want) {
+		t.Errorf("orderItems modified items in place: %q, want %q", got, want)
+	}
+
+	EnableHistory("test")
+	now := time.Now()
+	history := History{
+		"d": {Count: 1, Last: now.Add(-time.Hour).Unix()},
+		"c": {Count: 1, Last: now.Add(-10 * 24 * time.Hour).Unix()},
+		"b": {Count: 3, Last: now.Add(-10 * 24 * time.Hour).Unix()},
+	}
+	err := history.Save(historyKey("pick"))
+	if err != nil {
+		t.Fatalf("Save: unexpected error: %v", err)
+	}
+	if got, want := displays(orderItems(items, "pick")), []string{"d", "b", "c", "a"}; !slices.Equal(got, want) {
+		t.Errorf("orderItems with history = %q, want %q", got, want)
+	}
+	// NOTE: history is kept per prompt
+	if got, want := displays(orderItems(items, "other")), []string{"a", "b", "c", "d"}; !slices.Equal(got, want) {
+		t.Errorf("orderItems for other prompt = %q, want %q", got, want)
+	}
+
+	recordSelection("pick", Item{Display: "a"}, Item{Display: "d"})
+	recorded, err := HistoryFromStore(historyKey("pick"))
+	if err != nil {
+		t.Fatalf("HistoryFromStore: unexpected error: %v", err)
+	}
+	if recorded["a"].Count != 1 || recorded["d"].Count != 2 || recorded["b"].Count != 3 {
+		t.Errorf("recordSelection: history = %+v", recorded)
+	}
+}
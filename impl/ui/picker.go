@@ -0,0 +1,120 @@
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	ttyPath             = "/dev/tty"
+	pickerLinesCount    = 20
+	pickerCancelCommand = "q"
+)
+
+var ErrSelectionCancelled = errors.New("selection cancelled")
+
+// GetSelectionTerminal returns users choice from list of options, using built-in line-oriented terminal picker
+// Typing text narrows options down (all space-separated words should match), typing number picks respective option,
+// empty input picks the only option left, "q" or EOF cancels selection.
+// Text matching no options is returned as is, the same way as other selectors do, e.g. for free-form queries.
+func GetSelectionTerminal(seq []string, prompt string, caseInsensitive bool) (string, error) {
+	l := logger.Sugar()
+	in, out, closeFn := openTTY()
+	defer closeFn()
+	l.Debugw("[GetSelectionTerminal]", "seq", seq, "case-insensitive", caseInsensitive)
+
+	reader := bufio.NewReader(in)
+	if len(seq) == 0 {
+		fmt.Fprintf(out, "%s> ", prompt)
+		return readLine(reader)
+	}
+
+	matches := seq
+	for {
+		renderMatches(out, matches)
+		fmt.Fprintf(out, "%s [%d/%d]> ", prompt, len(matches), len(seq))
+		input, err := readLine(reader)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case input == pickerCancelCommand:
+			return "", ErrSelectionCancelled
+		case input == "":
+			if len(matches) == 1 {
+				return matches[0], nil
+			}
+		default:
+			if index, err := strconv.Atoi(input); err == nil && index >= 1 && index <= len(matches) {
+				return matches[index-1], nil
+			}
+			narrowed := filterMatches(matches, input, caseInsensitive)
+			if len(narrowed) == 0 {
+				l.Debugw("[GetSelectionTerminal]", "free-form input", input)
+				return input, nil
+			}
+			matches = narrowed
+		}
+	}
+}
+
+func openTTY() (io.Reader, io.Writer, func()) {
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return os.Stdin, os.Stderr, func() {}
+	}
+	return tty, tty, func() { tty.Close() }
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", ErrSelectionCancelled
+		}
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func renderMatches(out io.Writer, matches []string) {
+	for i, m := range matches {
+		if i == pickerLinesCount {
+			fmt.Fprintf(out, "  ... %d more\n", len(matches)-pickerLinesCount)
+			break
+		}
+		fmt.Fprintf(out, "%3d  %s\n", i+1, m)
+	}
+}
+
+func filterMatches(seq []string, query string, caseInsensitive bool) []string {
+	terms := strings.Fields(query)
+	if caseInsensitive {
+		for i, t := range terms {
+			terms[i] = strings.ToLower(t)
+		}
+	}
+	var result []string
+	for _, s := range seq {
+		candidate := s
+		if caseInsensitive {
+			candidate = strings.ToLower(s)
+		}
+		matched := true
+		for _, t := range terms {
+			if !strings.Contains(candidate, t) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			result = append(result, s)
+		}
+	}
+	return result
+}
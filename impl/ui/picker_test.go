@@ -0,0 +1,54 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFilterMatches(t *testing.T) {
+	seq := []string{"Firefox: GitHub", "firefox: docs", "Emacs: notes", "emacs: github issues"}
+	tests := []struct {
+		query           string
+		caseInsensitive bool
+		want            []string
+	}{
+		{"", false, seq},
+		{"Firefox", false, []string{"Firefox: GitHub"}},
+		{"firefox", true, []string{"Firefox: GitHub", "firefox: docs"}},
+		{"github emacs", true, []string{"emacs: github issues"}},
+		{"  github   issues ", false, []string{"emacs: github issues"}},
+		{"GITHUB", false, nil},
+		{"vim", true, nil},
+	}
+	for _, tt := range tests {
+		got := filterMatches(seq, tt.query, tt.caseInsensitive)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("filterMatches(%q, %v) = %q, want %q", tt.query, tt.caseInsensitive, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMatches(t *testing.T) {
+	var out bytes.Buffer
+	renderMatches(&out, []string{"a", "b"})
+	if got, want := out.String(), "  1  a\n  2  b\n"; got != want {
+		t.Errorf("renderMatches = %q, want %q", got, want)
+	}
+
+	var many []string
+	for i := 0; i < pickerLinesCount+5; i++ {
+		many = append(many, fmt.Sprintf("option %d", i))
+	}
+	out.Reset()
+	renderMatches(&out, many)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != pickerLinesCount+1 {
+		t.Fatalf("renderMatches rendered %d lines, want %d", len(lines), pickerLinesCount+1)
+	}
+	if got, want := lines[pickerLinesCount], "  ... 5 more"; got != want {
+		t.Errorf("renderMatches last line = %q, want %q", got, want)
+	}
+}
@@ -2,50 +2,239 @@ package ui
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"sort"
+	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/0xAX/notificator"
 	"github.com/wiedzmin/toolbox/impl"
+	"github.com/wiedzmin/toolbox/impl/notify"
 	"github.com/wiedzmin/toolbox/impl/shell"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
 	"go.uber.org/zap"
 )
 
 const (
 	rofiOptionsSeparator     = "\n"
+	rofiRowOptionsStart      = "\x00"
+	rofiRowOptionsSeparator  = "\x1f"
 	dmenuOptionsSeparator    = "\n"
 	dmenuSelectionLinesCount = 15
+	fzfOptionsSeparator      = "\n"
+	fzfExitNoMatch           = 1
+	fzfExitInterrupted       = 130
 
 	SelectorToolFlagName = "selector-tool"
 	SelectorToolDefault  = "dmenu"
 )
 
-var notify *notificator.Notificator
-var logger *zap.Logger
+var (
+	notifier *notificator.Notificator
+	logger   *zap.Logger
+
+	taggedIDs   = make(map[string]uint32)
+	taggedMutex sync.Mutex
+)
 
 func init() {
-	notify = notificator.New(notificator.Options{
+	notifier = notificator.New(notificator.Options{
 		// DefaultIcon: "icon/default.png",
 		AppName: "toolbox",
 	})
 	logger = impl.NewLogger()
 }
 
+// Item is a selection option: Display is what user sees, Value is what caller gets back
+// Icon and Meta (additional text to match against) are honored by selectors which support them, e.g. Rofi
+type Item struct {
+	Display string
+	Value   interface{}
+	Icon    string
+	Meta    string
+}
+
+// Items wraps plain strings into selection items, with values being the strings themselves
+func Items(seq []string) []Item {
+	result := make([]Item, 0, len(seq))
+	for _, s := range seq {
+		result = append(result, Item{Display: s, Value: s})
+	}
+	return result
+}
+
+// indexItems makes display strings unique, so that selected one could be unambiguously mapped back to its item
+func indexItems(items []Item) ([]string, map[string]Item) {
+	displays := make([]string, 0, len(items))
+	byDisplay := make(map[string]Item, len(items))
+	for _, item := range items {
+		display := item.Display
+		for n := 2; ; n++ {
+			if _, ok := byDisplay[display]; !ok {
+				break
+			}
+			display = fmt.Sprintf("%s (%d)", item.Display, n)
+		}
+		displays = append(displays, display)
+		byDisplay[display] = item
+	}
+	return displays, byDisplay
+}
+
+func rofiRows(items []Item, displays []string) []string {
+	result := make([]string, 0, len(items))
+	for i, item := range items {
+		var options []string
+		if item.Icon != "" {
+			options = append(options, "icon", item.Icon)
+		}
+		if item.Meta != "" {
+			options = append(options, "meta", item.Meta)
+		}
+		if len(options) == 0 {
+			result = append(result, displays[i])
+		} else {
+			result = append(result, fmt.Sprintf("%s%s%s", displays[i], rofiRowOptionsStart, strings.Join(options, rofiRowOptionsSeparator)))
+		}
+	}
+	return result
+}
+
 // GetSelection returns users choice from list of options, using predefined selector tool
-func GetSelection(seq []string, prompt, tool, font string, caseInsensitive, normalWindow bool) (string, error) {
+// Options are sorted alphabetically, then ranked by selection history, if enabled (see EnableHistory)
+// X-bound selectors are substituted with built-in terminal picker, when running in terminal with no X display available
+// If user input does not match any option, it is returned as both Display and Value of resulting item
+func GetSelection(items []Item, prompt, tool, font string, caseInsensitive, normalWindow bool) (*Item, error) {
 	l := logger.Sugar()
+	envTraits := impl.GetEnvTraits()
+	if envTraits.InShell && !envTraits.InX && tool != "fzf" {
+		l.Debugw("[GetSelection]", "tool", tool, "summary", "no X display, falling back to terminal picker")
+		tool = "term"
+	}
+	items = orderItems(items, prompt)
+	displays, byDisplay := indexItems(items)
+	var choice string
+	var err error
 	switch tool {
 	case "rofi":
-		return GetSelectionRofi(seq, prompt, caseInsensitive, normalWindow)
+		choice, err = GetSelectionRofi(rofiRows(items, displays), prompt, caseInsensitive, normalWindow)
 	case "dmenu":
-		return GetSelectionDmenu(seq, prompt, caseInsensitive, font)
+		choice, err = GetSelectionDmenu(displays, prompt, caseInsensitive, font)
 	case "bemenu":
-		return GetSelectionBemenu(seq, prompt, caseInsensitive, font)
+		choice, err = GetSelectionBemenu(displays, prompt, caseInsensitive, font)
+	case "fzf":
+		choice, err = GetSelectionFzf(displays, prompt, caseInsensitive)
+	case "term":
+		choice, err = GetSelectionTerminal(displays, prompt, caseInsensitive)
 	default:
 		l.Debugw("[GetSelection]", "tool", tool, "summary", fmt.Sprintf("unknown selector tool '%s'...", tool))
-		return "", fmt.Errorf("unknown selector tool: '%s'", tool)
+		return nil, fmt.Errorf("unknown selector tool: '%s'", tool)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if item, ok := byDisplay[choice]; ok {
+		recordSelection(prompt, item)
+		return &item, nil
+	}
+	l.Debugw("[GetSelection]", "choice", choice, "summary", "arbitrary input")
+	return &Item{Display: choice, Value: choice}, nil
+}
+
+// GetMultiSelection returns users choices from list of options, using predefined selector tool
+// Options are ordered the same way as for GetSelection
+// Rofi and Fzf support multiple selection natively, other tools are being run in a loop, with already selected
+// options removed, until selection is cancelled or an empty input is provided
+// Nothing being selected is reported as ErrSelectionCancelled
+func GetMultiSelection(items []Item, prompt, tool, font string, caseInsensitive, normalWindow bool) ([]Item, error) {
+	l := logger.Sugar()
+	envTraits := impl.GetEnvTraits()
+	if envTraits.InShell && !envTraits.InX && tool != "fzf" {
+		l.Debugw("[GetMultiSelection]", "tool", tool, "summary", "no X display, falling back to terminal picker")
+		tool = "term"
+	}
+	items = orderItems(items, prompt)
+	displays, byDisplay := indexItems(items)
+	var choices []string
+	var err error
+	switch tool {
+	case "rofi":
+		choices, err = GetMultiSelectionRofi(rofiRows(items, displays), prompt, caseInsensitive, normalWindow)
+	case "dmenu":
+		choices, err = multiSelectionLoop(displays, prompt, func(seq []string, prompt string) (string, error) {
+			return GetSelectionDmenu(seq, prompt, caseInsensitive, font)
+		})
+	case "bemenu":
+		choices, err = multiSelectionLoop(displays, prompt, func(seq []string, prompt string) (string, error) {
+			return GetSelectionBemenu(seq, prompt, caseInsensitive, font)
+		})
+	case "fzf":
+		choices, err = GetMultiSelectionFzf(displays, prompt, caseInsensitive)
+	case "term":
+		choices, err = multiSelectionLoop(displays, prompt, func(seq []string, prompt string) (string, error) {
+			return GetSelectionTerminal(seq, prompt, caseInsensitive)
+		})
+	default:
+		l.Debugw("[GetMultiSelection]", "tool", tool, "summary", fmt.Sprintf("unknown selector tool '%s'...", tool))
+		return nil, fmt.Errorf("unknown selector tool: '%s'", tool)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result, known []Item
+	for _, choice := range choices {
+		if item, ok := byDisplay[choice]; ok {
+			result = append(result, item)
+			known = append(known, item)
+		} else {
+			l.Debugw("[GetMultiSelection]", "choice", choice, "summary", "arbitrary input")
+			result = append(result, Item{Display: choice, Value: choice})
+		}
+	}
+	if len(result) == 0 {
+		return nil, ErrSelectionCancelled
+	}
+	recordSelection(prompt, known...)
+	return result, nil
+}
+
+// multiSelectionLoop emulates multiple selection for selectors which do not support it
+// Errors after the first successful selection are treated as finishing the loop, because that is how
+// Dmenu-alike tools report cancellation
+func multiSelectionLoop(seq []string, prompt string, selectFn func([]string, string) (string, error)) ([]string, error) {
+	l := logger.Sugar()
+	var result []string
+	remaining := append([]string{}, seq...)
+	for {
+		loopPrompt := prompt
+		if len(result) > 0 {
+			loopPrompt = fmt.Sprintf("%s (%d selected)", prompt, len(result))
+		}
+		choice, err := selectFn(append([]string{}, remaining...), loopPrompt)
+		l.Debugw("[multiSelectionLoop]", "choice", choice, "err", err)
+		if err != nil {
+			if len(result) == 0 {
+				return nil, err
+			}
+			return result, nil
+		}
+		if choice == "" {
+			return result, nil
+		}
+		result = append(result, choice)
+		for i, s := range remaining {
+			if s == choice {
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+		if len(remaining) == 0 && len(seq) > 0 {
+			return result, nil
+		}
 	}
 }
 
@@ -53,7 +242,6 @@ func GetSelection(seq []string, prompt, tool, font string, caseInsensitive, norm
 func GetSelectionRofi(seq []string, prompt string, caseInsensitive, normalWindow bool) (string, error) {
 	impl.EnsureBinary("rofi", *logger)
 	l := logger.Sugar()
-	sort.Strings(seq)
 	seqStr := strings.Join(seq, rofiOptionsSeparator)
 	l.Debugw("[GetSelectionRofi]", "seq", seq, "seqStr", seqStr, "normalWindow", normalWindow)
 	caseFlagStr := ""
@@ -78,7 +266,6 @@ func GetSelectionDmenu(seq []string, prompt string, caseInsensitive bool, font s
 	// $ echo hello | dmenu -w $(xdo id)
 	impl.EnsureBinary("dmenu", *logger)
 	l := logger.Sugar()
-	sort.Strings(seq)
 	seqStr := strings.Join(seq, dmenuOptionsSeparator)
 	l.Debugw("[GetSelectionDmenu]", "seq", seq, "seqStr", seqStr, "case-insensitive", caseInsensitive)
 	caseFlagStr := ""
@@ -103,7 +290,6 @@ func GetSelectionDmenu(seq []string, prompt string, caseInsensitive bool, font s
 func GetSelectionBemenu(seq []string, prompt string, caseInsensitive bool, font string) (string, error) {
 	impl.EnsureBinary("bemenu", *logger)
 	l := logger.Sugar()
-	sort.Strings(seq)
 	seqStr := strings.Join(seq, dmenuOptionsSeparator)
 	l.Debugw("[GetSelectionBemenu]", "seq", seq, "seqStr", seqStr, "case-insensitive", caseInsensitive)
 	caseFlagStr := ""
@@ -124,6 +310,96 @@ func GetSelectionBemenu(seq []string, prompt string, caseInsensitive bool, font
 	return *result, err
 }
 
+// GetSelectionFzf returns users choice from list of options, using Fzf selector tool
+// If nothing matches, typed query is returned, the same way as for Dmenu-alike tools
+func GetSelectionFzf(seq []string, prompt string, caseInsensitive bool) (string, error) {
+	impl.EnsureBinary("fzf", *logger)
+	l := logger.Sugar()
+	seqStr := strings.Join(seq, fzfOptionsSeparator)
+	l.Debugw("[GetSelectionFzf]", "seq", seq, "seqStr", seqStr, "case-insensitive", caseInsensitive)
+	result, err := proc.Output(context.Background(), fzfArgv(prompt, caseInsensitive, "--print-query"), proc.Options{Stdin: &seqStr})
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case fzfExitNoMatch:
+			err = nil
+		case fzfExitInterrupted:
+			return "", ErrSelectionCancelled
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	// NOTE: with --print-query, first line is the query itself, and the second one is the selection, if any
+	lines := strings.Split(result, "\n")
+	if len(lines) > 1 && lines[1] != "" {
+		return lines[1], nil
+	}
+	return lines[0], nil
+}
+
+// GetMultiSelectionRofi returns users choices from list of options, using Rofi selector tool in multi-select mode
+func GetMultiSelectionRofi(seq []string, prompt string, caseInsensitive, normalWindow bool) ([]string, error) {
+	impl.EnsureBinary("rofi", *logger)
+	l := logger.Sugar()
+	seqStr := strings.Join(seq, rofiOptionsSeparator)
+	l.Debugw("[GetMultiSelectionRofi]", "seq", seq, "seqStr", seqStr, "normalWindow", normalWindow)
+	caseFlagStr := ""
+	if caseInsensitive {
+		caseFlagStr = " -i"
+	}
+	normalWindowStr := ""
+	if normalWindow {
+		normalWindowStr = " -normal-window"
+	}
+	result, err := shell.ShellCmd(fmt.Sprintf("rofi%s -dmenu -multi-select%s -sep '%s' -p '%s'",
+		normalWindowStr, caseFlagStr, rofiOptionsSeparator, prompt), &seqStr, nil, nil, true, false)
+	if err != nil {
+		return nil, err
+	}
+	return splitSelectionLines(*result), nil
+}
+
+// GetMultiSelectionFzf returns users choices from list of options, using Fzf selector tool in multi-select mode
+func GetMultiSelectionFzf(seq []string, prompt string, caseInsensitive bool) ([]string, error) {
+	impl.EnsureBinary("fzf", *logger)
+	l := logger.Sugar()
+	seqStr := strings.Join(seq, fzfOptionsSeparator)
+	l.Debugw("[GetMultiSelectionFzf]", "seq", seq, "seqStr", seqStr, "case-insensitive", caseInsensitive)
+	result, err := proc.Output(context.Background(), fzfArgv(prompt, caseInsensitive, "--multi"), proc.Options{Stdin: &seqStr})
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case fzfExitNoMatch, fzfExitInterrupted:
+			return nil, ErrSelectionCancelled
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return splitSelectionLines(result), nil
+}
+
+// fzfArgv builds fzf command line, arguments are passed as is, so prompt needs no quoting
+func fzfArgv(prompt string, caseInsensitive bool, args ...string) []string {
+	caseFlag := "+i"
+	if caseInsensitive {
+		caseFlag = "-i"
+	}
+	result := []string{"fzf", caseFlag, "--prompt", prompt + "> "}
+	return append(result, args...)
+}
+
+func splitSelectionLines(output string) []string {
+	var result []string
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
 // ShowTextDialog runs textbox dialog window, then places provided text into it
 func ShowTextDialog(text, title string) error {
 	l := logger.Sugar()
@@ -158,12 +434,56 @@ func ShowTextDialog(text, title string) error {
 	return os.Remove(dataPath)
 }
 
-// TODO: make selector function for fzf, see example(s): https://junegunn.kr/2016/02/using-fzf-in-your-program
+// Notify shows desktop notification over D-Bus, falling back to `notify-send` if notifications server is unreachable
+// Returned id is zero in the latter case
+func Notify(n notify.Notification) uint32 {
+	l := logger.Sugar()
+	client, err := notify.Shared()
+	if err == nil {
+		var id uint32
+		id, err = client.Send(n)
+		if err == nil {
+			return id
+		}
+	}
+	l.Warnw("[Notify]", "err", err, "summary", "falling back to notify-send")
+	urgency := notificator.UR_NORMAL
+	if n.Urgency == notify.UrgencyCritical {
+		urgency = notificator.UR_CRITICAL
+	}
+	notifier.Push(n.Title, n.Body, n.Icon, urgency)
+	return 0
+}
 
 func NotifyNormal(title, text string) {
-	notify.Push(title, text, "", notificator.UR_NORMAL)
+	Notify(notify.Notification{Title: title, Body: text, Urgency: notify.UrgencyNormal})
 }
 
 func NotifyCritical(title, text string) {
-	notify.Push(title, text, "", notificator.UR_CRITICAL)
+	Notify(notify.Notification{Title: title, Body: text, Urgency: notify.UrgencyCritical})
+}
+
+// NotifyTagged shows notification, which replaces the previous one shown by this process with the same tag,
+// so that series of progress messages collapse into single updating one
+func NotifyTagged(tag, title, text string, urgency notify.Urgency) {
+	taggedMutex.Lock()
+	defer taggedMutex.Unlock()
+	id := Notify(notify.Notification{Title: title, Body: text, Urgency: urgency, ReplacesID: taggedIDs[tag]})
+	if id != 0 {
+		taggedIDs[tag] = id
+	}
+}
+
+// NotifyWithActions shows notification with action buttons and waits for user to either click one or dismiss it
+// If notifications server is unreachable, plain notification is shown and no action is taken
+func NotifyWithActions(title, text string, urgency notify.Urgency, timeout time.Duration, actions ...notify.Action) (string, error) {
+	l := logger.Sugar()
+	n := notify.Notification{Title: title, Body: text, Urgency: urgency, Timeout: timeout, Actions: actions}
+	client, err := notify.Shared()
+	if err != nil {
+		l.Warnw("[NotifyWithActions]", "err", err)
+		Notify(n)
+		return "", nil
+	}
+	return client.SendAndWait(n, timeout)
 }
@@ -0,0 +1,27 @@
+package ui
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFzfArgv(t *testing.T) {
+	tests := []struct {
+		prompt          string
+		caseInsensitive bool
+		args            []string
+		want            []string
+	}{
+		{"Pick", false, nil, []string{"fzf", "+i", "--prompt", "Pick> "}},
+		{"Pick", true, []string{"--multi"}, []string{"fzf", "-i", "--prompt", "Pick> ", "--multi"}},
+		// NOTE: prompt is a single argument, so quotes and shell syntax are kept as is
+		{"it's $HOME; rm -rf", false, []string{"--print-query"},
+			[]string{"fzf", "+i", "--prompt", "it's $HOME; rm -rf> ", "--print-query"}},
+	}
+	for _, tt := range tests {
+		got := fzfArgv(tt.prompt, tt.caseInsensitive, tt.args...)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("fzfArgv(%q, %v, %q) = %q, want %q", tt.prompt, tt.caseInsensitive, tt.args, got, tt.want)
+		}
+	}
+}
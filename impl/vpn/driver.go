@@ -0,0 +1,412 @@
+package vpn
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/wiedzmin/toolbox/impl"
+	"github.com/wiedzmin/toolbox/impl/shell"
+	"github.com/wiedzmin/toolbox/impl/shell/proc"
+)
+
+const (
+	pollInterval     = time.Second
+	attemptsInfinite = -1
+	ovpnAttemptsMax  = 15
+	// NOTE: nmcli waits for connection to (de)activate by itself, so state is expected to be settled almost immediately
+	ipsecAttemptsMax       = 3
+	nmAttemptsMax          = 3
+	wireguardAttemptsMax   = 10
+	openconnectAttemptsMax = 30
+
+	openconnectDeviceDefault = "tun0"
+	openconnectProcess       = "openconnect"
+
+	// wireguardHandshakeStale is how old the latest handshake could be for tunnel to be considered alive,
+	// peers handshake every 2 minutes, as long as there is traffic or keepalive is configured
+	wireguardHandshakeStale = 3 * time.Minute
+
+	nmStateActivated = "activated"
+)
+
+var nmcliEnv = []string{"LANGUAGE=en_US.en"}
+
+type ErrNotImplemented struct {
+	Name string
+	Type string
+}
+
+func (e ErrNotImplemented) Error() string {
+	return fmt.Sprintf("`%s` has unsupported type '%s'", e.Name, e.Type)
+}
+
+type ErrNoCommand struct {
+	Name      string
+	Operation string
+}
+
+func (e ErrNoCommand) Error() string {
+	return fmt.Sprintf("`%s` has no %s command configured", e.Name, e.Operation)
+}
+
+type ErrTransitionTimeout struct {
+	Name     string
+	Target   State
+	Attempts int
+}
+
+func (e ErrTransitionTimeout) Error() string {
+	return fmt.Sprintf("`%s` is still not %s after %d attempts", e.Name, e.Target, e.Attempts)
+}
+
+// driver hides service type specifics, so that bringing services up and down is handled uniformly
+type driver interface {
+	isUp() (bool, error)
+	up() error
+	down() error
+	attempts() int
+}
+
+type ovpnDriver struct {
+	device      string
+	upCommand   string
+	downCommand string
+}
+
+func (d ovpnDriver) isUp() (bool, error) {
+	_, err := os.Stat(ipV4StatusPath + d.device)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (d ovpnDriver) up() error {
+	_, err := shell.ShellCmd(d.upCommand, nil, nil, nil, false, false)
+	return err
+}
+
+func (d ovpnDriver) down() error {
+	_, err := shell.ShellCmd(d.downCommand, nil, nil, nil, false, false)
+	return err
+}
+
+func (d ovpnDriver) attempts() int {
+	return ovpnAttemptsMax
+}
+
+type ipsecDriver struct {
+	name        string
+	upCommand   string
+	downCommand string
+}
+
+func (d ipsecDriver) isUp() (bool, error) {
+	return nmIpsecVpnUp(d.name)
+}
+
+// runNmcli runs nmcli command, treating failures with benign output, e.g. "is already active", as success
+func runNmcli(cmd, benign string) error {
+	result, err := shell.ShellCmd(cmd, nil, nil, nmcliEnv, true, true)
+	if err != nil && result != nil && strings.Contains(*result, benign) {
+		return nil
+	}
+	return err
+}
+
+func (d ipsecDriver) up() error {
+	return runNmcli(d.upCommand, "is already active")
+}
+
+func (d ipsecDriver) down() error {
+	return runNmcli(d.downCommand, "not an active")
+}
+
+func (d ipsecDriver) attempts() int {
+	return ipsecAttemptsMax
+}
+
+// handshaker is implemented by drivers, which are able to tell when tunnel has last heard from peer
+type handshaker interface {
+	latestHandshake() (time.Time, error)
+}
+
+func deviceExists(device string) (bool, error) {
+	_, err := os.Stat(ipV4StatusPath + device)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// runConfigured runs configured shell command, if any, falling back to argv otherwise
+func runConfigured(cmd string, argv []string) error {
+	if cmd != "" {
+		_, err := shell.ShellCmd(cmd, nil, nil, nil, false, false)
+		return err
+	}
+	return proc.Run(context.Background(), argv, proc.Options{})
+}
+
+// nmDriver handles arbitrary NetworkManager connections, commands are optional and override nmcli defaults
+type nmDriver struct {
+	connection  string
+	upCommand   string
+	downCommand string
+}
+
+func (d nmDriver) isUp() (bool, error) {
+	impl.EnsureBinary("nmcli", *logger)
+	// NOTE: inactive connections have no GENERAL.* fields, so output is empty for them
+	out, err := proc.Output(context.Background(), []string{"nmcli", "-g", "GENERAL.STATE", "connection", "show", "id", d.connection},
+		proc.Options{Env: nmcliEnv})
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) == nmStateActivated, nil
+}
+
+func (d nmDriver) up() error {
+	if d.upCommand != "" {
+		return runNmcli(d.upCommand, "is already active")
+	}
+	return proc.Run(context.Background(), []string{"nmcli", "connection", "up", "id", d.connection}, proc.Options{Env: nmcliEnv})
+}
+
+func (d nmDriver) down() error {
+	if d.downCommand != "" {
+		return runNmcli(d.downCommand, "not an active")
+	}
+	err := proc.Run(context.Background(), []string{"nmcli", "connection", "down", "id", d.connection}, proc.Options{Env: nmcliEnv})
+	// NOTE: connection could have gone down by itself meanwhile
+	if up, upErr := d.isUp(); err != nil && upErr == nil && !up {
+		return nil
+	}
+	return err
+}
+
+func (d nmDriver) attempts() int {
+	return nmAttemptsMax
+}
+
+// wireguardDriver brings tunnel up either with NetworkManager, if connection is set, or with wg-quick
+type wireguardDriver struct {
+	device      string
+	connection  string
+	upCommand   string
+	downCommand string
+}
+
+func (d wireguardDriver) isUp() (bool, error) {
+	return deviceExists(d.device)
+}
+
+func (d wireguardDriver) nm() nmDriver {
+	return nmDriver{connection: d.connection, upCommand: d.upCommand, downCommand: d.downCommand}
+}
+
+func (d wireguardDriver) up() error {
+	if d.connection != "" {
+		return d.nm().up()
+	}
+	return runConfigured(d.upCommand, []string{"wg-quick", "up", d.device})
+}
+
+func (d wireguardDriver) down() error {
+	if d.connection != "" {
+		return d.nm().down()
+	}
+	return runConfigured(d.downCommand, []string{"wg-quick", "down", d.device})
+}
+
+func (d wireguardDriver) attempts() int {
+	return wireguardAttemptsMax
+}
+
+// latestHandshake returns the most recent handshake among tunnel peers, zero time if there were none yet
+// NOTE: `wg show` needs CAP_NET_ADMIN, so it could fail for regular users
+func (d wireguardDriver) latestHandshake() (time.Time, error) {
+	out, err := proc.Output(context.Background(), []string{"wg", "show", d.device, "latest-handshakes"}, proc.Options{})
+	if err != nil {
+		return time.Time{}, err
+	}
+	var latest int64
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		ts, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if ts > latest {
+			latest = ts
+		}
+	}
+	if latest == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(latest, 0), nil
+}
+
+// openconnectDriver needs up command to be configured, as there are too many ways to authenticate,
+// command should make openconnect detach, e.g. with `--background`, otherwise it would block forever
+// Going down needs either down command, or pidfile, written by up command with `--pid-file`, as there could be
+// other openconnect processes around, which are none of our business
+type openconnectDriver struct {
+	name        string
+	device      string
+	pidFile     string
+	upCommand   string
+	downCommand string
+}
+
+func (d openconnectDriver) isUp() (bool, error) {
+	return deviceExists(d.device)
+}
+
+func (d openconnectDriver) up() error {
+	if d.upCommand == "" {
+		return ErrNoCommand{Name: d.name, Operation: "up"}
+	}
+	return runConfigured(d.upCommand, nil)
+}
+
+// down makes openconnect log out from server, which SIGINT is meant for, unless down command is configured
+func (d openconnectDriver) down() error {
+	if d.downCommand != "" {
+		return runConfigured(d.downCommand, nil)
+	}
+	if d.pidFile == "" {
+		return ErrNoCommand{Name: d.name, Operation: "down"}
+	}
+	// NOTE: stale pidfile could point to some unrelated process, which has reused the pid meanwhile
+	alive, err := pidAlive(d.pidFile, openconnectProcess)
+	if err != nil {
+		return err
+	}
+	if !alive {
+		return nil // NOTE: nothing to stop, tunnel is going to be checked by caller anyway
+	}
+	pid, err := readPidFile(d.pidFile)
+	if err != nil {
+		return err
+	}
+	return syscall.Kill(pid, syscall.SIGINT)
+}
+
+func (d openconnectDriver) attempts() int {
+	return openconnectAttemptsMax
+}
+
+// driver returns driver for service type, ErrNotImplemented for unknown types
+func (s *Service) driver() (driver, error) {
+	switch s.Type {
+	case "ovpn":
+		return ovpnDriver{device: s.Device, upCommand: s.UpCommand, downCommand: s.DownCommand}, nil
+	case "ipsec":
+		return ipsecDriver{name: s.Name, upCommand: s.UpCommand, downCommand: s.DownCommand}, nil
+	case "nm":
+		return nmDriver{connection: s.connection(), upCommand: s.UpCommand, downCommand: s.DownCommand}, nil
+	case "wireguard":
+		device := s.Device
+		if device == "" {
+			device = s.Name
+		}
+		return wireguardDriver{device: device, connection: s.Connection, upCommand: s.UpCommand, downCommand: s.DownCommand}, nil
+	case "openconnect":
+		device := s.Device
+		if device == "" {
+			device = openconnectDeviceDefault
+		}
+		return openconnectDriver{name: s.Name, device: device, pidFile: s.PidFile, upCommand: s.UpCommand,
+			downCommand: s.DownCommand}, nil
+	}
+	return nil, ErrNotImplemented{Name: s.Name, Type: s.Type}
+}
+
+// connection returns NetworkManager connection name, which defaults to service name
+func (s *Service) connection() string {
+	if s.Connection != "" {
+		return s.Connection
+	}
+	return s.Name
+}
+
+// transition brings service either up or down, unless it is already there, waiting for it to settle down
+// Every step is recorded, see Status, failures leave service in StateFailed along with error
+func (s *Service) transition(target State, notify bool) error {
+	l := logger.Sugar()
+	wantUp := target == StateUp
+	transitional, action, progress, done := StateStopping, "stopping", "Stopping", "Stopped"
+	if wantUp {
+		transitional, action, progress, done = StateStarting, "starting", "Starting", "Started"
+	}
+	fail := func(err error) error {
+		l.Debugw(fmt.Sprintf("[%s.transition]", s.Name), "target", target, "err", err)
+		recordState(s.Name, StateFailed, err)
+		if notify {
+			notifyFailure(s.Name, fmt.Sprintf("Error %s `%s` service:\n\n%s", action, s.Name, err.Error()))
+		}
+		return err
+	}
+
+	// NOTE: unsupported services are not failed ones, so nothing is recorded for them
+	d, err := s.driver()
+	if err != nil {
+		if notify {
+			notifyFailure(s.Name, err.Error())
+		}
+		return err
+	}
+	isUp, err := d.isUp()
+	if err != nil {
+		return fail(err)
+	}
+	if isUp == wantUp {
+		recordState(s.Name, target, nil)
+		if notify {
+			notifyProgress(s.Name, fmt.Sprintf("`%s` is %s", s.Name, target))
+		}
+		return nil
+	}
+
+	recordState(s.Name, transitional, nil)
+	if notify {
+		notifyProgress(s.Name, fmt.Sprintf("%s `%s`...", progress, s.Name))
+	}
+	if wantUp {
+		err = d.up()
+	} else {
+		err = d.down()
+	}
+	if err != nil {
+		return fail(err)
+	}
+	attempts := d.attempts()
+	for attempt := 1; ; attempt++ {
+		isUp, err = d.isUp()
+		if err != nil {
+			return fail(err)
+		}
+		if isUp == wantUp {
+			break
+		}
+		if attempts != attemptsInfinite && attempt >= attempts {
+			return fail(ErrTransitionTimeout{Name: s.Name, Target: target, Attempts: attempts})
+		}
+		time.Sleep(pollInterval)
+	}
+	l.Debugw(fmt.Sprintf("[%s.transition]", s.Name), "target", target)
+	recordState(s.Name, target, nil)
+	if notify {
+		notifyProgress(s.Name, fmt.Sprintf("%s `%s` service", done, s.Name))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package vpn
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestServiceDriver(t *testing.T) {
+	tests := []struct {
+		name    string
+		service Service
+		want    driver
+	}{
+		{"ovpn", Service{Name: "office", Type: "ovpn", Device: "tun1", UpCommand: "up", DownCommand: "down"},
+			ovpnDriver{device: "tun1", upCommand: "up", downCommand: "down"}},
+		{"ipsec", Service{Name: "office", Type: "ipsec", UpCommand: "up", DownCommand: "down"},
+			ipsecDriver{name: "office", upCommand: "up", downCommand: "down"}},
+		{"nm, default connection", Service{Name: "office", Type: "nm"}, nmDriver{connection: "office"}},
+		{"nm", Service{Name: "office", Type: "nm", Connection: "Office VPN"}, nmDriver{connection: "Office VPN"}},
+		{"wireguard, default device", Service{Name: "wg-home", Type: "wireguard"}, wireguardDriver{device: "wg-home"}},
+		{"wireguard over nm", Service{Name: "home", Type: "wireguard", Device: "wg0", Connection: "Home"},
+			wireguardDriver{device: "wg0", connection: "Home"}},
+		{"openconnect, default device", Service{Name: "corp", Type: "openconnect", UpCommand: "up"},
+			openconnectDriver{name: "corp", device: openconnectDeviceDefault, upCommand: "up"}},
+		{"openconnect", Service{Name: "corp", Type: "openconnect", Device: "tun5", UpCommand: "up", DownCommand: "down"},
+			openconnectDriver{name: "corp", device: "tun5", upCommand: "up", downCommand: "down"}},
+		{"openconnect with pidfile", Service{Name: "corp", Type: "openconnect", UpCommand: "up", PidFile: "/run/corp.pid"},
+			openconnectDriver{name: "corp", device: openconnectDeviceDefault, pidFile: "/run/corp.pid", upCommand: "up"}},
+	}
+	for _, tt := range tests {
+		got, err := tt.service.driver()
+		if err != nil {
+			t.Errorf("%s: driver: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: driver = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+
+	for _, serviceType := range []string{"", "pptp"} {
+		s := Service{Name: "legacy", Type: serviceType}
+		_, err := s.driver()
+		var notImplemented ErrNotImplemented
+		if !errors.As(err, &notImplemented) || notImplemented.Type != serviceType {
+			t.Errorf("driver for type %q: got error %v, want ErrNotImplemented", serviceType, err)
+		}
+	}
+}
+
+func TestOpenconnectDriverNoCommands(t *testing.T) {
+	d := openconnectDriver{name: "corp", device: openconnectDeviceDefault}
+	var noCommand ErrNoCommand
+	if err := d.up(); !errors.As(err, &noCommand) || noCommand.Operation != "up" {
+		t.Errorf("up: got error %v, want ErrNoCommand", err)
+	}
+	if err := d.down(); !errors.As(err, &noCommand) || noCommand.Operation != "down" {
+		t.Errorf("down: got error %v, want ErrNoCommand", err)
+	}
+}
+
+func TestOpenconnectDriverDownPidFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tests := []struct {
+		name    string
+		pidFile string
+		wantErr bool
+	}{
+		{"no pidfile", filepath.Join(dir, "missing.pid"), false},
+		// NOTE: pid of test process itself stands for reused one, as it is not openconnect - it should survive
+		{"pid reused", write("reused.pid", strconv.Itoa(os.Getpid())+"\n"), false},
+		{"malformed pidfile", write("malformed.pid", "not a pid"), true},
+	}
+	for _, tt := range tests {
+		s := Service{Name: "corp", Type: "openconnect", UpCommand: "up", PidFile: tt.pidFile}
+		d, err := s.driver()
+		if err != nil {
+			t.Fatalf("%s: driver: unexpected error: %v", tt.name, err)
+		}
+		err = d.down()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: down error = %v, want error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package vpn
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	procRoutePath = "/proc/net/route"
+
+	// NOTE: comm is truncated by kernel to 15 characters
+	procCommLenMax = 15
+
+	// transitionGracePeriod keeps reconcile away from transitions, which are still in progress
+	transitionGracePeriod = 2 * time.Minute
+
+	routeFlagUp = 0x1
+)
+
+// route is IPv4 routing table entry, as exposed by kernel
+type route struct {
+	Iface       string
+	Destination net.IPNet
+}
+
+// LiveStatus is service state as seen in the live system, as opposed to the recorded one
+// Unchecked aspects are left nil, e.g. process liveness for services with neither process name nor pidfile configured
+type LiveStatus struct {
+	Name           string
+	Connected      bool
+	DefaultRoute   bool
+	MissingSubnets []string
+	ProcessAlive   *bool
+
+	LatestHandshake *time.Time
+}
+
+// State derives service state out of live system one, partially set up services are treated as failed,
+// along with the reason why
+func (s LiveStatus) State() (State, error) {
+	processAlive := s.ProcessAlive != nil && *s.ProcessAlive
+	if !s.Connected && !processAlive {
+		return StateDown, nil
+	}
+	if !s.Connected {
+		return StateFailed, fmt.Errorf("process is running, yet `%s` is not connected", s.Name)
+	}
+	if s.ProcessAlive != nil && !processAlive {
+		return StateFailed, fmt.Errorf("`%s` is connected, yet its process is not running", s.Name)
+	}
+	if s.LatestHandshake != nil {
+		if s.LatestHandshake.IsZero() {
+			return StateFailed, fmt.Errorf("`%s` is connected, yet there was no handshake with peer", s.Name)
+		}
+		if time.Since(*s.LatestHandshake) > wireguardHandshakeStale {
+			return StateFailed, fmt.Errorf("`%s` is connected, yet the latest handshake was %s ago", s.Name,
+				time.Since(*s.LatestHandshake).Round(time.Second))
+		}
+	}
+	if len(s.MissingSubnets) > 0 {
+		return StateFailed, fmt.Errorf("`%s` is connected, yet there are no routes for %s", s.Name, strings.Join(s.MissingSubnets, ", "))
+	}
+	return StateUp, nil
+}
+
+// Details renders live status in a short human-readable form
+func (s LiveStatus) Details() string {
+	var result []string
+	if s.Connected {
+		result = append(result, "connected")
+	} else {
+		result = append(result, "disconnected")
+	}
+	if s.DefaultRoute {
+		result = append(result, "default route")
+	}
+	if len(s.MissingSubnets) > 0 {
+		result = append(result, fmt.Sprintf("unrouted: %s", strings.Join(s.MissingSubnets, ",")))
+	}
+	if s.LatestHandshake != nil {
+		if s.LatestHandshake.IsZero() {
+			result = append(result, "no handshake")
+		} else {
+			result = append(result, fmt.Sprintf("handshake %s ago", time.Since(*s.LatestHandshake).Round(time.Second)))
+		}
+	}
+	if s.ProcessAlive != nil {
+		if *s.ProcessAlive {
+			result = append(result, "process alive")
+		} else {
+			result = append(result, "process dead")
+		}
+	}
+	return strings.Join(result, ", ")
+}
+
+// parseRouteAddr decodes address from routing table, which is hex-encoded in host byte order
+func parseRouteAddr(s string) (net.IP, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != net.IPv4len {
+		return nil, fmt.Errorf("malformed route address: '%s'", s)
+	}
+	result := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(result, binary.LittleEndian.Uint32(data))
+	return result, nil
+}
+
+// readRoutes returns IPv4 routes, which are up, from routing table formatted the way procRoutePath is
+func readRoutes(path string) ([]route, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var result []route
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // NOTE: skipping header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		var flags uint
+		_, err = fmt.Sscanf(fields[3], "%x", &flags)
+		if err != nil || flags&routeFlagUp == 0 {
+			continue
+		}
+		dest, err := parseRouteAddr(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		mask, err := parseRouteAddr(fields[7])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, route{Iface: fields[0], Destination: net.IPNet{IP: dest, Mask: net.IPMask(mask)}})
+	}
+	return result, scanner.Err()
+}
+
+func (r route) isDefault() bool {
+	ones, _ := r.Destination.Mask.Size()
+	return ones == 0
+}
+
+// covers tells if route sends the whole subnet through its interface
+func (r route) covers(subnet *net.IPNet) bool {
+	routeOnes, _ := r.Destination.Mask.Size()
+	subnetOnes, _ := subnet.Mask.Size()
+	return routeOnes <= subnetOnes && r.Destination.Contains(subnet.IP)
+}
+
+func commMatches(comm []byte, name string) bool {
+	if len(name) > procCommLenMax {
+		name = name[:procCommLenMax]
+	}
+	return strings.TrimSpace(string(comm)) == name
+}
+
+// readPidFile returns pid from pidfile, 0 if there is no pidfile, i.e. nothing was started
+func readPidFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("malformed pidfile '%s'", path)
+	}
+	return pid, nil
+}
+
+// pidAlive tells if process from pidfile is still running, and, if name is provided, is the expected one,
+// as stale pidfiles could point to pids, which were reused meanwhile
+func pidAlive(path, name string) (bool, error) {
+	pid, err := readPidFile(path)
+	if err != nil || pid == 0 {
+		return false, err
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return name == "" || commMatches(data, name), nil
+}
+
+// processAlive tells if there is process with provided executable name
+func processAlive(name string) (bool, error) {
+	paths, err := filepath.Glob("/proc/[0-9]*/comm")
+	if err != nil {
+		return false, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue // NOTE: process could have exited meanwhile
+		}
+		if commMatches(data, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Live inspects live system for service state, i.e. connection itself, routes and process
+// Routes are checked against service device, if any, so that the same subnets routed elsewhere would not count,
+// otherwise any route but default one is accepted
+func (s *Service) Live() (*LiveStatus, error) {
+	d, err := s.driver()
+	if err != nil {
+		return nil, err
+	}
+	result := LiveStatus{Name: s.Name}
+	result.Connected, err = d.isUp()
+	if err != nil {
+		return nil, err
+	}
+	// NOTE: pidfile pins down the very process of service, while name could match someone else's one
+	if s.PidFile != "" || s.Process != "" {
+		var alive bool
+		if s.PidFile != "" {
+			alive, err = pidAlive(s.PidFile, s.Process)
+		} else {
+			alive, err = processAlive(s.Process)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.ProcessAlive = &alive
+	}
+	if !result.Connected {
+		return &result, nil
+	}
+	if h, ok := d.(handshaker); ok {
+		handshake, err := h.latestHandshake()
+		if err != nil {
+			logger.Sugar().Warnw(fmt.Sprintf("[%s.Live]", s.Name), "err", err)
+		} else {
+			result.LatestHandshake = &handshake
+		}
+	}
+	routes, err := readRoutes(procRoutePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range routes {
+		if r.isDefault() && s.Device != "" && r.Iface == s.Device {
+			result.DefaultRoute = true
+		}
+	}
+	result.MissingSubnets, err = s.missingSubnets(routes)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// missingSubnets returns service subnets, which are not routed through service device
+func (s *Service) missingSubnets(routes []route) ([]string, error) {
+	// NOTE: without device to check against, default route would cover any subnet, no matter where it leads,
+	// so only dedicated routes count then
+	viaDevice := func(r route) bool {
+		if s.Device == "" {
+			return !r.isDefault()
+		}
+		return r.Iface == s.Device
+	}
+	var result []string
+	for _, subnet := range s.Subnets {
+		_, network, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, err
+		}
+		routed := false
+		for _, r := range routes {
+			if viaDevice(r) && r.covers(network) {
+				routed = true
+				break
+			}
+		}
+		if !routed {
+			result = append(result, subnet)
+		}
+	}
+	return result, nil
+}
+
+// Reconcile brings recorded state of service in line with the live one, returning the latter
+// Transitions in progress are left alone for a while, as live state lags behind them
+func (s *Service) Reconcile() (*LiveStatus, error) {
+	l := logger.Sugar()
+	live, err := s.Live()
+	if err != nil {
+		return nil, err
+	}
+	status, err := GetStatus(s.Name)
+	if err != nil {
+		return nil, err
+	}
+	if (status.State == StateStarting || status.State == StateStopping) && status.Duration() < transitionGracePeriod {
+		return live, nil
+	}
+	state, cause := live.State()
+	if state == status.State && (cause == nil || cause.Error() == status.LastError) {
+		return live, nil
+	}
+	l.Debugw(fmt.Sprintf("[%s.Reconcile]", s.Name), "recorded", status.State, "live", state, "cause", cause)
+	recordState(s.Name, state, cause)
+	return live, nil
+}
@@ -0,0 +1,212 @@
+package vpn
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const routesFixturePath = "testdata/route"
+
+func TestParseRouteAddr(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want string
+	}{
+		{"00000000", "0.0.0.0"},
+		{"0101A8C0", "192.168.1.1"},
+		{"0000080A", "10.8.0.0"},
+		{"00FFFFFF", "255.255.255.0"},
+		{"FFFFFFFF", "255.255.255.255"},
+	}
+	for _, tt := range tests {
+		got, err := parseRouteAddr(tt.hex)
+		if err != nil {
+			t.Errorf("parseRouteAddr(%s): unexpected error: %v", tt.hex, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("parseRouteAddr(%s) = %s, want %s", tt.hex, got, tt.want)
+		}
+	}
+	for _, malformed := range []string{"", "0101A8", "0101A8C000", "XYZ0A8C0"} {
+		if _, err := parseRouteAddr(malformed); err == nil {
+			t.Errorf("parseRouteAddr(%q): expected error", malformed)
+		}
+	}
+}
+
+func TestReadRoutes(t *testing.T) {
+	routes, err := readRoutes(routesFixturePath)
+	if err != nil {
+		t.Fatalf("readRoutes: unexpected error: %v", err)
+	}
+	var got []string
+	for _, r := range routes {
+		got = append(got, r.Iface+" "+r.Destination.String())
+	}
+	// NOTE: routes which are not up and malformed lines are skipped
+	want := []string{
+		"eth0 0.0.0.0/0",
+		"eth0 192.168.1.0/24",
+		"tun0 10.8.0.0/16",
+		"tun0 10.20.30.0/24",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("readRoutes = %q, want %q", got, want)
+	}
+	if !routes[0].isDefault() || routes[1].isDefault() {
+		t.Errorf("isDefault: only the first route should be the default one")
+	}
+}
+
+func TestRouteCovers(t *testing.T) {
+	tests := []struct {
+		route  string
+		subnet string
+		want   bool
+	}{
+		{"0.0.0.0/0", "10.1.2.0/24", true},
+		{"10.8.0.0/16", "10.8.0.0/16", true},
+		{"10.8.0.0/16", "10.8.5.0/24", true},
+		{"10.8.0.0/16", "10.8.5.7/32", true},
+		{"10.8.0.0/16", "10.0.0.0/8", false},
+		{"10.8.0.0/16", "10.9.0.0/24", false},
+		{"10.20.30.0/24", "10.20.0.0/16", false},
+	}
+	for _, tt := range tests {
+		_, destination, _ := net.ParseCIDR(tt.route)
+		_, subnet, _ := net.ParseCIDR(tt.subnet)
+		r := route{Iface: "tun0", Destination: *destination}
+		if got := r.covers(subnet); got != tt.want {
+			t.Errorf("route %s covers %s = %v, want %v", tt.route, tt.subnet, got, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		route string
+		want  bool
+	}{
+		{"0.0.0.0/0", true},
+		{"10.8.0.0/16", false},
+		{"192.168.1.1/32", false},
+	} {
+		_, destination, _ := net.ParseCIDR(tt.route)
+		r := route{Iface: "eth0", Destination: *destination}
+		if got := r.isDefault(); got != tt.want {
+			t.Errorf("route %s isDefault = %v, want %v", tt.route, got, tt.want)
+		}
+	}
+}
+
+func TestMissingSubnets(t *testing.T) {
+	routes, err := readRoutes(routesFixturePath)
+	if err != nil {
+		t.Fatalf("readRoutes: unexpected error: %v", err)
+	}
+	tests := []struct {
+		name    string
+		device  string
+		subnets []string
+		want    []string
+	}{
+		{"routed through device", "tun0", []string{"10.8.1.0/24", "10.20.30.0/24"}, nil},
+		{"partially routed", "tun0", []string{"10.8.0.0/16", "10.9.0.0/16"}, []string{"10.9.0.0/16"}},
+		{"routed elsewhere", "wg0", []string{"10.8.0.0/16", "192.168.1.0/24"}, []string{"10.8.0.0/16", "192.168.1.0/24"}},
+		{"default route of other device", "tun0", []string{"172.16.0.0/12"}, []string{"172.16.0.0/12"}},
+		{"no device, dedicated route", "", []string{"10.8.0.0/16"}, nil},
+		{"no device, default route only", "", []string{"172.16.0.0/12"}, []string{"172.16.0.0/12"}},
+	}
+	for _, tt := range tests {
+		s := Service{Name: "test", Device: tt.device, Subnets: tt.subnets}
+		got, err := s.missingSubnets(routes)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: missingSubnets = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	s := Service{Name: "test", Subnets: []string{"not a subnet"}}
+	if _, err := s.missingSubnets(routes); err == nil {
+		t.Errorf("missingSubnets: expected error for malformed subnet")
+	}
+}
+
+func TestLiveStatusState(t *testing.T) {
+	yes, no := true, false
+	recent := time.Now().Add(-time.Minute)
+	stale := time.Now().Add(-time.Hour)
+	var never time.Time
+	tests := []struct {
+		name    string
+		status  LiveStatus
+		want    State
+		wantErr bool
+	}{
+		{"down", LiveStatus{}, StateDown, false},
+		{"down, process dead", LiveStatus{ProcessAlive: &no}, StateDown, false},
+		{"process without connection", LiveStatus{ProcessAlive: &yes}, StateFailed, true},
+		{"up", LiveStatus{Connected: true}, StateUp, false},
+		{"up, process alive", LiveStatus{Connected: true, ProcessAlive: &yes}, StateUp, false},
+		{"up, process dead", LiveStatus{Connected: true, ProcessAlive: &no}, StateFailed, true},
+		{"up, recent handshake", LiveStatus{Connected: true, LatestHandshake: &recent}, StateUp, false},
+		{"up, stale handshake", LiveStatus{Connected: true, LatestHandshake: &stale}, StateFailed, true},
+		{"up, no handshake", LiveStatus{Connected: true, LatestHandshake: &never}, StateFailed, true},
+		{"up, unrouted subnets", LiveStatus{Connected: true, MissingSubnets: []string{"10.0.0.0/8"}}, StateFailed, true},
+	}
+	for _, tt := range tests {
+		tt.status.Name = "test"
+		got, err := tt.status.State()
+		if got != tt.want {
+			t.Errorf("%s: State() = %s, want %s", tt.name, got, tt.want)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: State() error = %v, want error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPidAlive(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	self := write("self.pid", strconv.Itoa(os.Getpid())+"\n")
+	comm, err := os.ReadFile("/proc/self/comm")
+	if err != nil {
+		t.Skipf("no procfs: %v", err)
+	}
+	tests := []struct {
+		name    string
+		path    string
+		process string
+		want    bool
+		wantErr bool
+	}{
+		{"alive", self, "", true, false},
+		{"alive, expected process", self, strings.TrimSpace(string(comm)), true, false},
+		{"alive, pid reused", self, "openconnect", false, false},
+		{"no pidfile", filepath.Join(dir, "missing.pid"), "", false, false},
+		{"malformed pidfile", write("malformed.pid", "not a pid"), "", false, true},
+	}
+	for _, tt := range tests {
+		got, err := pidAlive(tt.path, tt.process)
+		if got != tt.want {
+			t.Errorf("%s: pidAlive = %v, want %v", tt.name, got, tt.want)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: pidAlive error = %v, want error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package vpn
+
+import (
+	"fmt"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/wiedzmin/toolbox/impl/store"
+)
+
+// State is VPN service lifecycle state, as seen by toolbox
+type State string
+
+const (
+	StateDown     State = "down"
+	StateStarting State = "starting"
+	StateUp       State = "up"
+	StateStopping State = "stopping"
+	StateFailed   State = "failed"
+)
+
+// Status is the last recorded state transition of service, Since is a unix timestamp, zero if never recorded
+type Status struct {
+	Name      string `json:"-"`
+	State     State  `json:"state"`
+	Since     int64  `json:"since"`
+	LastError string `json:"error,omitempty"`
+}
+
+// Duration returns how long service has been in its current state, zero if unknown
+func (s Status) Duration() time.Duration {
+	if s.Since == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(s.Since, 0)).Round(time.Second)
+}
+
+func statusKey(name string) string {
+	return fmt.Sprintf("vpn/%s/status", name)
+}
+
+// legacyUpStateKey is kept up to date for external consumers, e.g. status bars, which read it directly
+func legacyUpStateKey(name string) string {
+	return fmt.Sprintf("vpn/%s/is_up", name)
+}
+
+func legacyUpState(state State) string {
+	switch state {
+	case StateUp:
+		return "yes"
+	case StateDown:
+		return "no"
+	}
+	return "unk"
+}
+
+// GetStatus returns recorded status of service, services with nothing recorded are reported down
+func GetStatus(name string) (*Status, error) {
+	r, err := store.Shared()
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.GetValue(statusKey(name))
+	if err != nil {
+		return nil, err
+	}
+	result := Status{Name: name, State: StateDown}
+	if len(data) == 0 {
+		return &result, nil
+	}
+	err = jsoniter.Unmarshal(data, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// recordState stores state transition, timestamp is only updated when state actually changes
+// Errors are cleared on reaching either up or down state, so that stale ones would not linger around
+func recordState(name string, state State, cause error) {
+	l := logger.Sugar()
+	r, err := store.Shared()
+	if err != nil {
+		l.Warnw("[recordState]", "name", name, "state", state, "err", err)
+		return
+	}
+	status, err := GetStatus(name)
+	if err != nil {
+		l.Warnw("[recordState]", "name", name, "state", state, "err", err)
+		status = &Status{Name: name}
+	}
+	if status.State != state || status.Since == 0 {
+		status.Since = time.Now().Unix()
+	}
+	status.State = state
+	switch {
+	case cause != nil:
+		status.LastError = cause.Error()
+	case state == StateUp || state == StateDown:
+		status.LastError = ""
+	}
+	data, err := jsoniter.Marshal(status)
+	if err != nil {
+		l.Warnw("[recordState]", "name", name, "state", state, "err", err)
+		return
+	}
+	l.Debugw("[recordState]", "name", name, "state", state, "cause", cause)
+	err = r.SetValue(statusKey(name), string(data))
+	if err != nil {
+		l.Warnw("[recordState]", "name", name, "state", state, "err", err)
+	}
+	err = r.SetValue(legacyUpStateKey(name), legacyUpState(state))
+	if err != nil {
+		l.Warnw("[recordState]", "name", name, "state", state, "err", err)
+	}
+}
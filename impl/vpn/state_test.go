@@ -0,0 +1,66 @@
+package vpn
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/wiedzmin/toolbox/impl/store"
+)
+
+func TestRecordState(t *testing.T) {
+	r := store.NewMemory(nil)
+	store.Use(r)
+	t.Cleanup(func() { store.Use(nil) })
+
+	status, err := GetStatus("work")
+	if err != nil {
+		t.Fatalf("GetStatus: unexpected error: %v", err)
+	}
+	if status.State != StateDown || status.Since != 0 || status.Duration() != 0 {
+		t.Errorf("GetStatus for nothing recorded = %+v, want down since never", status)
+	}
+
+	check := func(step string, state State, lastError, legacy string) *Status {
+		t.Helper()
+		status, err := GetStatus("work")
+		if err != nil {
+			t.Fatalf("%s: GetStatus: unexpected error: %v", step, err)
+		}
+		if status.Name != "work" || status.State != state || status.LastError != lastError || status.Since == 0 {
+			t.Errorf("%s: status = %+v, want %s with error %q", step, status, state, lastError)
+		}
+		data, err := r.GetValue(legacyUpStateKey("work"))
+		if err != nil || string(data) != legacy {
+			t.Errorf("%s: legacy state = %q, %v, want %q", step, data, err, legacy)
+		}
+		return status
+	}
+
+	recordState("work", StateStarting, nil)
+	check("starting", StateStarting, "", "unk")
+
+	// NOTE: pretend that service has been up for a while, so that timestamp updates are observable
+	recordState("work", StateUp, nil)
+	up := check("up", StateUp, "", "yes")
+	up.Since -= 3600
+	err = r.SetValue(statusKey("work"), `{"state":"up","since":`+strconv.FormatInt(up.Since, 10)+`}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordState("work", StateUp, nil)
+	if got := check("still up", StateUp, "", "yes"); got.Since != up.Since {
+		t.Errorf("still up: since = %d, want unchanged %d", got.Since, up.Since)
+	}
+
+	recordState("work", StateFailed, errors.New("tunnel is gone"))
+	failed := check("failed", StateFailed, "tunnel is gone", "unk")
+	if failed.Since == up.Since {
+		t.Errorf("failed: since was not updated on state change")
+	}
+	// NOTE: errors linger through transitional states, e.g. while retrying
+	recordState("work", StateStopping, nil)
+	check("stopping", StateStopping, "tunnel is gone", "unk")
+	recordState("work", StateDown, nil)
+	check("down", StateDown, "", "no")
+}
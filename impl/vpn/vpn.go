@@ -3,31 +3,26 @@ package vpn
 import (
 	"bufio"
 	"fmt"
-	"os"
+	"sort"
 	"strings"
-	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/wiedzmin/toolbox/impl"
-	"github.com/wiedzmin/toolbox/impl/redis"
+	"github.com/wiedzmin/toolbox/impl/notify"
 	"github.com/wiedzmin/toolbox/impl/shell"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"github.com/wiedzmin/toolbox/impl/systemd"
 	"github.com/wiedzmin/toolbox/impl/ui"
 	"go.uber.org/zap"
 )
 
 const (
-	ipV4StatusPath       = "/proc/sys/net/ipv4/conf/"
-	ovpnAttemptsMax      = 15
-	ovpnAttemptsInfinite = -1
+	ipV4StatusPath = "/proc/sys/net/ipv4/conf/"
 )
 
 var nmVpnActiveStatusCodes = []string{"3", "5"}
 
-var (
-	logger *zap.Logger
-	r      *redis.Client
-)
+var logger *zap.Logger
 
 type ServiceNotFound struct {
 	Name string
@@ -37,12 +32,20 @@ func (e ServiceNotFound) Error() string {
 	return fmt.Sprintf("service `%s` not found", e.Name)
 }
 
+// Service is VPN service metadata, Subnets (CIDRs), Process (executable name) and PidFile are optional and only used for
+// inspecting live state, see Live; PidFile also lets "openconnect" services go down without down command
+// Type is one of "ovpn", "ipsec", "wireguard", "openconnect" or "nm", Connection is NetworkManager connection name,
+// used by "nm" (defaults to service name) and "wireguard" (wg-quick is used if omitted) services
 type Service struct {
 	Name        string
-	Type        string `json:"type"`
-	Device      string `json:"dev"`
-	UpCommand   string `json:"up"`
-	DownCommand string `json:"down"`
+	Type        string   `json:"type"`
+	Device      string   `json:"dev"`
+	UpCommand   string   `json:"up"`
+	DownCommand string   `json:"down"`
+	Connection  string   `json:"connection,omitempty"`
+	Subnets     []string `json:"subnets,omitempty"`
+	Process     string   `json:"process,omitempty"`
+	PidFile     string   `json:"pidfile,omitempty"`
 }
 
 type Services struct {
@@ -52,12 +55,15 @@ type Services struct {
 
 func init() {
 	logger = impl.NewLogger()
-	var err error
-	r, err = redis.NewRedisLocal()
-	if err != nil {
-		l := logger.Sugar()
-		l.Fatalw("[init]", "failed connecting to Redis", err)
-	}
+}
+
+// notifyProgress shows VPN service state change, replacing previous notification about the same service
+func notifyProgress(name, text string) {
+	ui.NotifyTagged("vpn/"+name, "[VPN]", text, notify.UrgencyNormal)
+}
+
+func notifyFailure(name, text string) {
+	ui.NotifyTagged("vpn/"+name, "[VPN]", text, notify.UrgencyCritical)
 }
 
 func NewServices(data []byte) (*Services, error) {
@@ -70,8 +76,8 @@ func NewServices(data []byte) (*Services, error) {
 	return &result, nil
 }
 
-func ServicesFromRedis(key string) (*Services, error) {
-	r, err := redis.NewRedisLocal()
+func ServicesFromStore(key string) (*Services, error) {
+	r, err := store.Shared()
 	if err != nil {
 		return nil, err
 	}
@@ -139,217 +145,52 @@ func (vm *Services) StopRunning(omit []string, notify bool) error {
 			continue
 		}
 		l.Debugw("[StopRunning]", "name", name)
-		ui.NotifyNormal("[VPN]", fmt.Sprintf("Stopping `%s`...", name))
 		vm.Get(name).Stop(notify) // FIXME: check for nonexistent service
 	}
 	return nil
 }
 
-func startOVPN(name, device, cmd string, attempts int, notify bool) error {
+// Start brings service up, unless it is already up
+func (s *Service) Start(notify bool) error {
 	l := logger.Sugar()
-	tun_path := fmt.Sprintf("%s%s", ipV4StatusPath, device)
-	l.Debugw("[startOVPN]", "name", name, "device", device, "cmd", cmd, "attempts", attempts, "notify", notify)
-	l.Debugw("[startOVPN]", "tun_path", tun_path)
-	if _, err := os.Stat(tun_path); !os.IsNotExist(err) {
-		r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "yes")
-		if notify {
-			ui.NotifyNormal("[VPN]", fmt.Sprintf("`%s` is up", name))
-		}
-		return nil
-	} else {
-		success := false
-		_, err := shell.ShellCmd(cmd, nil, nil, nil, false, false)
-		if err == nil {
-			attempt := 0
-			for {
-				if _, err := os.Stat(tun_path); !os.IsNotExist(err) {
-					success = true
-					break
-				}
-				time.Sleep(1 * time.Second)
-				if attempts != ovpnAttemptsInfinite {
-					attempt++
-					if attempt >= attempts {
-						err = fmt.Errorf("failed to start service for %d attempts", attempts)
-						break
-					}
-				}
-			}
-		}
-		if success {
-			r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "yes")
-			l.Debugw("[startOVPN]", fmt.Sprintf("vpn/%s/is_up", name), "yes")
-			if notify {
-				ui.NotifyNormal("[VPN]", fmt.Sprintf("Started `%s` service", name))
-			}
-			return nil
-		} else {
-			r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "unk")
-			l.Debugw("[startOVPN]", fmt.Sprintf("vpn/%s/is_up", name), "unk")
-			if notify {
-				ui.NotifyCritical("[VPN]", fmt.Sprintf("Error starting `%s` service:\n\n%s", name, err.Error()))
-			}
-			return err
-		}
-	}
+	l.Debugw(fmt.Sprintf("[%s.Start]", s.Name), "meta", s, "notify", notify)
+	return s.transition(StateUp, notify)
 }
 
-func startIPSec(name, cmd string, notify bool) error {
+// Stop brings service down, unless it is already down
+func (s *Service) Stop(notify bool) error {
 	l := logger.Sugar()
-	up, err := nmIpsecVpnUp(name)
-	if err != nil {
-		return err
-	}
-	if up {
-		r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "yes")
-		l.Debugw("[startIPSec]", fmt.Sprintf("vpn/%s/is_up", name), "yes")
-		if notify {
-			ui.NotifyNormal("[VPN]", fmt.Sprintf("`%s` is up", name))
-		}
-		return nil
-	} else {
-		result, err := shell.ShellCmd(cmd, nil, nil, []string{"LANGUAGE=en_US.en"}, true, true)
-		if err != nil {
-			if strings.Contains(*result, "is already active") {
-				r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "yes")
-				l.Debugw("[startIPSec]", fmt.Sprintf("vpn/%s/is_up", name), "yes")
-				if notify {
-					ui.NotifyNormal("[VPN]", fmt.Sprintf("`%s` is up", name))
-				}
-				return nil
-			} else {
-				r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "unk")
-				l.Debugw("[startIPSec]", fmt.Sprintf("vpn/%s/is_up", name), "unk")
-				if notify {
-					ui.NotifyCritical("[VPN]", fmt.Sprintf("Error starting `%s` service:\n\n%s", name, err.Error()))
-				}
-				return err
-			}
-		} else {
-			r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "yes")
-			l.Debugw("[startIPSec]", fmt.Sprintf("vpn/%s/is_up", name), "yes")
-			if notify {
-				ui.NotifyNormal("[VPN]", fmt.Sprintf("`%s` is up", name))
-			}
-			return nil
-		}
-	}
+	l.Debugw(fmt.Sprintf("[%s.Stop]", s.Name), "meta", s, "notify", notify)
+	return s.transition(StateDown, notify)
 }
 
-func stopOVPN(name, device, cmd string, attempts int, notify bool) error {
+// Reconcile brings recorded states of all services in line with live ones, see Service.Reconcile
+// Services, which could not be inspected, are reported and skipped
+func (vm *Services) Reconcile() map[string]*LiveStatus {
 	l := logger.Sugar()
-	tun_path := fmt.Sprintf("%s%s", ipV4StatusPath, device)
-	l.Debugw("[stopOVPN]", "name", name, "device", device, "cmd", cmd, "attempts", attempts, "notify", notify)
-	l.Debugw("[stopOVPN]", "tun_path", tun_path)
-	if _, err := os.Stat(tun_path); !os.IsNotExist(err) {
-		r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "no")
-		l.Debugw("[stopOVPN]", fmt.Sprintf("vpn/%s/is_up", name), "no")
-		if notify {
-			ui.NotifyNormal("[VPN]", fmt.Sprintf("`%s` is down", name))
-		}
-		return nil
-	} else {
-		success := false
-		_, err := shell.ShellCmd(cmd, nil, nil, nil, false, false)
-		if err == nil {
-			attempt := 0
-			for {
-				if _, err := os.Stat(tun_path); os.IsNotExist(err) {
-					success = true
-					break
-				}
-				time.Sleep(1 * time.Second)
-				if attempts != ovpnAttemptsInfinite {
-					attempt++
-					if attempt >= attempts {
-						err = fmt.Errorf("failed to start service for %d attempts", attempts)
-						break
-					}
-				}
-			}
-		}
-		if success {
-			r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "no")
-			l.Debugw("[stopOVPN]", fmt.Sprintf("vpn/%s/is_up", name), "no")
-			if notify {
-				ui.NotifyNormal("[VPN]", fmt.Sprintf("Stopped `%s` service", name))
-			}
-			return nil
-		} else {
-			r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "unk")
-			l.Debugw("[stopOVPN]", fmt.Sprintf("vpn/%s/is_up", name), "unk")
-			if notify {
-				ui.NotifyCritical("[VPN]", fmt.Sprintf("Error stopping `%s` service:\n\n%s", name, err.Error()))
-			}
-			return err
+	result := make(map[string]*LiveStatus)
+	for _, name := range vm.Names() {
+		live, err := vm.Get(name).Reconcile()
+		if err != nil {
+			l.Warnw("[Reconcile]", "name", name, "err", err)
+			continue
 		}
+		result[name] = live
 	}
+	return result
 }
 
-func stopIPSec(name, cmd string, notify bool) error {
-	l := logger.Sugar()
-	up, err := nmIpsecVpnUp(name)
-	if err != nil {
-		return err
-	}
-	if !up {
-		r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "no")
-		l.Debugw("[stopIPSec]", fmt.Sprintf("vpn/%s/is_up", name), "no")
-		if notify {
-			ui.NotifyNormal("[VPN]", fmt.Sprintf("`%s` is down", name))
-		}
-		return nil
-	} else {
-		result, err := shell.ShellCmd(cmd, nil, nil, []string{"LANGUAGE=en_US.en"}, true, true)
+// Statuses returns recorded statuses of all services, sorted by name
+func (vm *Services) Statuses() ([]Status, error) {
+	names := vm.Names()
+	sort.Strings(names)
+	var result []Status
+	for _, name := range names {
+		status, err := GetStatus(name)
 		if err != nil {
-			if strings.Contains(*result, "not an active") {
-				r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "no")
-				l.Debugw("[stopIPSec]", fmt.Sprintf("vpn/%s/is_up", name), "no")
-				if notify {
-					ui.NotifyNormal("[VPN]", fmt.Sprintf("`%s` is down", name))
-				}
-				return nil
-			} else {
-				r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "unk")
-				l.Debugw("[stopIPSec]", fmt.Sprintf("vpn/%s/is_up", name), "unk")
-				if notify {
-					ui.NotifyCritical("[VPN]", fmt.Sprintf("Error stopping `%s` service:\n\n%s", name, err.Error()))
-				}
-				return err
-			}
-		} else {
-			r.SetValue(fmt.Sprintf("vpn/%s/is_up", name), "no")
-			l.Debugw("[stopIPSec]", fmt.Sprintf("vpn/%s/is_up", name), "no")
-			if notify {
-				ui.NotifyNormal("[VPN]", fmt.Sprintf("`%s` is down", name))
-			}
-			return nil
+			return nil, err
 		}
+		result = append(result, *status)
 	}
-}
-
-func (s *Service) Start(notify bool) error {
-	l := logger.Sugar()
-	l.Debugw(fmt.Sprintf("[%s.Start]", s.Name), "meta", s, "notify", notify)
-	ui.NotifyNormal("[VPN]", fmt.Sprintf("Starting `%s`...", s.Name))
-	switch s.Type {
-	case "ovpn":
-		return startOVPN(s.Name, s.Device, s.UpCommand, ovpnAttemptsMax, notify)
-	case "ipsec":
-		return startIPSec(s.Name, s.UpCommand, notify)
-	}
-	return nil
-}
-
-func (s *Service) Stop(notify bool) error {
-	l := logger.Sugar()
-	l.Debugw(fmt.Sprintf("[%s.Stop]", s.Name), "meta", s, "notify", notify)
-	ui.NotifyNormal("[VPN]", fmt.Sprintf("Stopping `%s`...", s.Name))
-	switch s.Type {
-	case "ovpn":
-		return stopOVPN(s.Name, s.Device, s.DownCommand, ovpnAttemptsMax, notify)
-	case "ipsec":
-		return stopIPSec(s.Name, s.DownCommand, notify)
-	}
-	return nil
+	return result, nil
 }
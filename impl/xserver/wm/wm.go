@@ -7,7 +7,8 @@ import (
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/wiedzmin/toolbox/impl"
-	"github.com/wiedzmin/toolbox/impl/redis"
+	"github.com/wiedzmin/toolbox/impl/store"
+	"github.com/wiedzmin/toolbox/impl/ui"
 	"go.uber.org/zap"
 )
 
@@ -39,7 +40,6 @@ type Keybindings struct {
 	data         []byte
 	parsed       []Keybinding
 	modeBindings map[string]Keys
-	partsHelper  map[string]KeybindingFormattedParts
 	modeNames    []string
 }
 
@@ -60,10 +60,7 @@ type FnFormatKBParts func(*Keybinding, *Modebinding) KeybindingFormattedParts
 
 type FnFormatKBPartsStr func(KeybindingFormattedParts) string
 
-var (
-	logger *zap.Logger
-	r      *redis.Client
-)
+var logger *zap.Logger
 
 const (
 	keyNameDangling = "dangling"
@@ -72,13 +69,7 @@ const (
 )
 
 func init() {
-	var err error
 	logger = impl.NewLogger()
-	r, err = redis.NewRedisLocal()
-	if err != nil {
-		l := logger.Sugar()
-		l.Fatalw("[init]", "failed connecting to Redis", err)
-	}
 }
 
 type ErrLinkBroken struct {
@@ -99,7 +90,11 @@ func NewWorkspaces(data []byte) (*Workspaces, error) {
 	return &result, nil
 }
 
-func WorkspacesFromRedis(key string) (*Workspaces, error) {
+func WorkspacesFromStore(key string) (*Workspaces, error) {
+	r, err := store.Shared()
+	if err != nil {
+		return nil, err
+	}
 	workspacesData, err := r.GetValue(key)
 	if err != nil {
 		return nil, err
@@ -129,7 +124,11 @@ func NewModebindings(data []byte) (*Modebindings, error) {
 	return &result, nil
 }
 
-func ModebindingsFromRedis(key string) (*Modebindings, error) {
+func ModebindingsFromStore(key string) (*Modebindings, error) {
+	r, err := store.Shared()
+	if err != nil {
+		return nil, err
+	}
 	modebindingsData, err := r.GetValue(key)
 	if err != nil {
 		return nil, err
@@ -194,7 +193,11 @@ func NewKeybindings(data []byte) (*Keybindings, error) {
 	return &result, nil
 }
 
-func KeybindingsFromRedis(key string) (*Keybindings, error) {
+func KeybindingsFromStore(key string) (*Keybindings, error) {
+	r, err := store.Shared()
+	if err != nil {
+		return nil, err
+	}
 	keybindingsData, err := r.GetValue(key)
 	if err != nil {
 		return nil, err
@@ -243,15 +246,6 @@ func (kb *Keybindings) Items(fnFormat FnFormatKBParts, sortModes bool) (map[stri
 	return result, nil
 }
 
-func (kb *Keybindings) GetPartsForSelection(selection string) (*KeybindingFormattedParts, error) {
-	parts, ok := kb.partsHelper[selection]
-	if !ok {
-		return nil, fmt.Errorf("no parts found for selection")
-	}
-
-	return &parts, nil
-}
-
 func FormatPartsCommon(k *Keybinding, mb *Modebinding) KeybindingFormattedParts {
 	var result KeybindingFormattedParts
 
@@ -307,39 +301,28 @@ func FormatTextIndented(parts KeybindingFormattedParts) string {
 		parts.Key, parts.Mode, parts.LeaveFullscreen, parts.Raw, parts.Cmd)
 }
 
-func (kb *Keybindings) Fuzzy(fnFormat FnFormatKBPartsStr) ([]string, error) {
+// Fuzzy returns keybindings as selector items, each one carrying respective KeybindingFormattedParts as Value
+func (kb *Keybindings) Fuzzy(fnFormat FnFormatKBPartsStr) ([]ui.Item, error) {
 	kbItems, err := kb.Items(FormatPartsCommon, true)
 	if err != nil {
 		return nil, err
 	}
 
-	var result []string
-	var formattedStr string
-	kb.partsHelper = make(map[string]KeybindingFormattedParts)
+	var result []ui.Item
+	appendParts := func(partsSlice []KeybindingFormattedParts) {
+		for _, parts := range partsSlice {
+			result = append(result, ui.Item{Display: fnFormat(parts), Value: parts})
+		}
+	}
 
-	partsRoot := kbItems[keyNameRoot]
-	partsDangling, okDangling := kbItems[keyNameDangling]
 	for _, mode := range kb.modeNames {
-		partsMode, okMode := kbItems[mode]
-		if okMode {
-			for _, parts := range partsMode {
-				formattedStr = fnFormat(parts)
-				kb.partsHelper[formattedStr] = parts
-				result = append(result, formattedStr)
-			}
+		if partsMode, ok := kbItems[mode]; ok {
+			appendParts(partsMode)
 		}
 	}
-	for _, parts := range partsRoot {
-		formattedStr = fnFormat(parts)
-		kb.partsHelper[formattedStr] = parts
-		result = append(result, formattedStr)
-	}
-	if okDangling {
-		for _, parts := range partsDangling {
-			formattedStr = fnFormat(parts)
-			kb.partsHelper[formattedStr] = parts
-			result = append(result, formattedStr)
-		}
+	appendParts(kbItems[keyNameRoot])
+	if partsDangling, ok := kbItems[keyNameDangling]; ok {
+		appendParts(partsDangling)
 	}
 
 	return result, nil
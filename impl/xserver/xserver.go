@@ -12,24 +12,15 @@ import (
 	"github.com/jezek/xgbutil/icccm"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/wiedzmin/toolbox/impl"
-	"github.com/wiedzmin/toolbox/impl/redis"
 	"github.com/wiedzmin/toolbox/impl/shell"
+	"github.com/wiedzmin/toolbox/impl/store"
 	"go.uber.org/zap"
 )
 
-var (
-	logger *zap.Logger
-	r      *redis.Client
-)
+var logger *zap.Logger
 
 func init() {
 	logger = impl.NewLogger()
-	var err error
-	r, err = redis.NewRedisLocal()
-	if err != nil {
-		l := logger.Sugar()
-		l.Fatalw("[init]", "failed connecting to Redis", err)
-	}
 	impl.EnsureBinary("xkb-switch", *logger)
 }
 
@@ -266,7 +257,11 @@ func NewWindowRules(data []byte) (*WindowRules, error) {
 	return &result, nil
 }
 
-func WindowRulesFromRedis(key string) (*WindowRules, error) {
+func WindowRulesFromStore(key string) (*WindowRules, error) {
+	r, err := store.Shared()
+	if err != nil {
+		return nil, err
+	}
 	rulesData, err := r.GetValue(key)
 	if err != nil {
 		return nil, err
@@ -356,7 +351,11 @@ func NewWorkspaces(data []byte) (*Workspaces, error) {
 	return &result, nil
 }
 
-func WorkspacesFromRedis(key string) (*Workspaces, error) {
+func WorkspacesFromStore(key string) (*Workspaces, error) {
+	r, err := store.Shared()
+	if err != nil {
+		return nil, err
+	}
 	workspacesData, err := r.GetValue(key)
 	if err != nil {
 		return nil, err